@@ -0,0 +1,177 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// resolveCache persists the labels that imports resolved to between runs, in
+// a file of json lines named by js_resolve_cache. The first line holds a hash
+// of the configuration and of the rule index; when it does not match the
+// current run, the file is started over, so that BUILD file or directive
+// changes never serve stale labels.
+type resolveCache struct {
+	mu      sync.Mutex
+	inputs  map[string]bool
+	opened  bool
+	file    *os.File
+	entries map[string]resolveCacheEntry
+}
+
+type resolveCacheHeader struct {
+	Hash string `json:"hash"`
+}
+
+type resolveCacheEntry struct {
+	Key  string   `json:"key"`
+	Deps []string `json:"deps,omitempty"`
+	Data []string `json:"data,omitempty"`
+}
+
+func newResolveCache() *resolveCache {
+	return &resolveCache{
+		inputs:  make(map[string]bool),
+		entries: make(map[string]resolveCacheEntry),
+	}
+}
+
+// addInput adds a line of configuration or index state to the hash that the
+// cache file must match.
+func (rc *resolveCache) addInput(input string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.inputs[input] = true
+}
+
+// hash returns the hash of the inputs, independent of the order they were
+// added in.
+func (rc *resolveCache) hash() string {
+	inputs := make([]string, 0, len(rc.inputs))
+	for input := range rc.inputs {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	h := sha256.New()
+	for _, input := range inputs {
+		h.Write([]byte(input))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// open loads the entries of the cache file at cachePath, once the rule index
+// is complete, and keeps it open to append new entries. It reports whether the
+// cache can be used.
+func (rc *resolveCache) open(cachePath string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.opened {
+		return rc.file != nil
+	}
+	rc.opened = true
+
+	hash := rc.hash()
+	if existing, err := os.Open(cachePath); err == nil {
+		scanner := bufio.NewScanner(existing)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		var header resolveCacheHeader
+		if scanner.Scan() && json.Unmarshal(scanner.Bytes(), &header) == nil && header.Hash == hash {
+			for scanner.Scan() {
+				var entry resolveCacheEntry
+				if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+					rc.entries[entry.Key] = entry
+				}
+			}
+		}
+		existing.Close()
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if len(rc.entries) == 0 {
+		// stale or missing, start over
+		flags |= os.O_TRUNC
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		log.Print(Err("failed to create resolve cache %s: %v", cachePath, err))
+		return false
+	}
+	file, err := os.OpenFile(cachePath, flags, 0644)
+	if err != nil {
+		log.Print(Err("failed to open resolve cache %s: %v", cachePath, err))
+		return false
+	}
+	if flags&os.O_TRUNC != 0 {
+		if err := rc.write(file, resolveCacheHeader{Hash: hash}); err != nil {
+			log.Print(Err("failed to write resolve cache %s: %v", cachePath, err))
+			file.Close()
+			return false
+		}
+	}
+	rc.file = file
+	return true
+}
+
+// get returns the cached resolution of key
+func (rc *resolveCache) get(key string) (resolveCacheEntry, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	entry, ok := rc.entries[key]
+	return entry, ok
+}
+
+// put caches the deps and data that key resolved to
+func (rc *resolveCache) put(key string, deps map[string]bool, data map[string]bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.file == nil {
+		return
+	}
+	entry := resolveCacheEntry{Key: key, Deps: sortedKeys(deps), Data: sortedKeys(data)}
+	rc.entries[key] = entry
+	if err := rc.write(rc.file, entry); err != nil {
+		log.Print(Err("failed to write resolve cache %s: %v", rc.file.Name(), err))
+		rc.file.Close()
+		rc.file = nil
+	}
+}
+
+func (rc *resolveCache) write(file *os.File, line interface{}) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
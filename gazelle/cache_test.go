@@ -0,0 +1,101 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestResolveCache(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"lib/util.ts", "app/main.ts"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cachePath := filepath.Join(repoRoot, ".gazelle_js_cache")
+
+	// resolveDeps runs gazelle with the given root directives and name for the
+	// rule of lib/util.ts
+	resolveDeps := func(directives []rule.Directive, ruleName string) []string {
+		lang := NewLanguage()
+		c := newResolveConfig(t, repoRoot)
+		lang.Configure(c, "", &rule.File{
+			Pkg:        "",
+			Directives: append([]rule.Directive{{Key: "js_root"}, {Key: "js_resolve_cache", Value: ".gazelle_js_cache"}}, directives...),
+		})
+		f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+		lang.Configure(c, "lib", f)
+		lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+		util := rule.NewRule("ts_project", ruleName)
+		util.SetAttr("srcs", []string{"util.ts"})
+		ix.AddRule(c, util, f)
+		ix.Finish()
+
+		r := rule.NewRule("ts_project", "main")
+		r.SetAttr("srcs", []string{"main.ts"})
+		lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"../lib/util": true}}, label.New("", "app", "main"))
+		return r.AttrStrings("deps")
+	}
+
+	if deps, want := resolveDeps(nil, "util"), []string{"//lib:util"}; !reflect.DeepEqual(deps, want) {
+		t.Fatalf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+
+	// the same configuration reads the cache, so a tampered entry shows up
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	if len(lines) != 2 || !strings.Contains(lines[1], "//lib:util") {
+		t.Fatalf("expected a header and an entry for //lib:util, got %q", data)
+	}
+	tampered := lines[0] + "\n" + strings.ReplaceAll(lines[1], "//lib:util", "//lib:stale")
+	if err := os.WriteFile(cachePath, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if deps, want := resolveDeps(nil, "util"), []string{"//lib:stale"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+
+	// a directive change invalidates the cache
+	if deps, want := resolveDeps([]rule.Directive{{Key: "js_quiet"}}, "util"), []string{"//lib:util"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+
+	// and so does a change of the rules in BUILD files
+	if deps, want := resolveDeps([]rule.Directive{{Key: "js_quiet"}}, "helpers"), []string{"//lib:helpers"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+	if data, err := os.ReadFile(cachePath); err != nil || strings.Contains(string(data), "//lib:stale") || strings.Contains(string(data), "//lib:util") {
+		t.Errorf("expected the cache to be started over, got %q, %v", data, err)
+	}
+}
@@ -17,6 +17,7 @@
 package js
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -25,10 +26,12 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
 	"github.com/bazelbuild/bazel-gazelle/rule"
 	"github.com/bazelbuild/buildtools/labels"
 )
@@ -78,6 +81,74 @@ type JsConfig struct {
 	JestConfig         string
 	JestTestsPerShard  int
 	JestSize           string
+	GeneratedBarrels   map[string]label.Label
+	PrintOnly          bool
+	TypesMapping       map[string]string
+	IndexExclusions    []string
+	ExclusionPattern   *regexp.Regexp
+	CaseInsensitive    bool
+	BuiltinPolyfills   map[string]string
+	PackageLabel       string
+	ScopedPackageFiles bool
+	NoDataKinds        map[string]bool
+	BarrelPattern      *regexp.Regexp
+	LabelStyle         string
+	ImportQueries      map[string]string
+	PackageName        string
+	PackageDir         string
+	PackageExports     map[string]string
+	AmbientModules     []string
+	AmbientPattern     *regexp.Regexp
+	VendorDirs         []string
+	AggregatorKinds    map[string]bool
+	NodeTypes          bool
+	ImplicitDeps       []string
+	Bundle             label.Label
+	MetaResolve        string
+	NpmAliases         map[string]string
+	TypeDepsAttr       string
+	HTMLEntrypoints    bool
+	NpmLabelSuffix     string
+	FirstParty         map[string]label.Label
+	DirImportFallback  string
+	WorkspacePackages  map[string]bool
+	PackageType        string
+	GenruleOuts        bool
+	CollectAllKinds    map[string]bool
+	ExtensionPriority  []string
+	MaxDepsWarn        int
+	EntryFields        []string
+	PackageEntries     map[string]string
+	ProjectReferences  []string
+	ResolveFromRoot    bool
+	QuietRelative      bool
+	OutDirs            map[string]string
+	IncludePkgFiles    bool
+	IndexCoverage      bool
+	BrowserMap         bool
+	BrowserRemaps      map[string]string
+	ExpandTemplates    bool
+	MocksDir           string
+	DevDepRuntimeKinds map[string]bool
+	ResolveCache       string
+	DepCommentPattern  *regexp.Regexp
+	GenSuffixes        map[string]string
+	CSSModuleTypes     bool
+	VirtualPrefixes    map[string]label.Label
+	ExportConditions   []string
+	PackageExportsRaw  json.RawMessage
+	PackageImportsRaw  json.RawMessage
+	FilesystemIndex    bool
+	GraphExport        string
+	ExternalRepos      map[string]string
+	RootDirs           []string
+	PreserveEmptyDeps  map[string]bool
+	CollectAllFallback bool
+	RuleNameSuffixes   []string
+	IgnoredSuffixes    []string
+	DepPrecedence      string
+	ContextAttr        string
+	Context            string
 }
 
 func NewJsConfig() *JsConfig {
@@ -97,21 +168,89 @@ func NewJsConfig() *JsConfig {
 		Visibility: Visibility{
 			Labels: []string{},
 		},
-		CollectBarrels:    false,
-		CollectWebAssets:  false,
-		CollectAllAssets:  false,
-		CollectedAssets:   make(map[string]bool),
-		CollectAll:        false,
-		CollectAllRoot:    "",
-		CollectAllSources: make(map[string]bool),
-		Fix:               false,
-		JSRoot:            "/",
-		WebAssetSuffixes:  make(map[string]bool),
-		Quiet:             false,
-		Verbose:           false,
-		DefaultNpmLabel:   "//:node_modules/",
-		JestTestsPerShard: -1,
-		JestConfig:        "",
+		CollectBarrels:     false,
+		CollectWebAssets:   false,
+		CollectAllAssets:   false,
+		CollectedAssets:    make(map[string]bool),
+		CollectAll:         false,
+		CollectAllRoot:     "",
+		CollectAllSources:  make(map[string]bool),
+		Fix:                false,
+		JSRoot:             "/",
+		WebAssetSuffixes:   make(map[string]bool),
+		Quiet:              false,
+		Verbose:            false,
+		DefaultNpmLabel:    "//:node_modules/",
+		JestTestsPerShard:  -1,
+		JestConfig:         "",
+		GeneratedBarrels:   make(map[string]label.Label),
+		PrintOnly:          false,
+		TypesMapping:       make(map[string]string),
+		IndexExclusions:    []string{},
+		ExclusionPattern:   regexp.MustCompile("$^"),
+		CaseInsensitive:    false,
+		BuiltinPolyfills:   make(map[string]string),
+		PackageLabel:       "",
+		ScopedPackageFiles: false,
+		NoDataKinds:        make(map[string]bool),
+		BarrelPattern:      indexFilePattern,
+		LabelStyle:         "",
+		ImportQueries:      make(map[string]string),
+		PackageName:        "",
+		PackageDir:         "",
+		PackageExports:     make(map[string]string),
+		AmbientModules:     []string{},
+		AmbientPattern:     regexp.MustCompile("$^"),
+		VendorDirs:         []string{},
+		AggregatorKinds:    make(map[string]bool),
+		NodeTypes:          true,
+		ImplicitDeps:       []string{},
+		Bundle:             label.NoLabel,
+		MetaResolve:        "dep",
+		NpmAliases:         make(map[string]string),
+		TypeDepsAttr:       "",
+		HTMLEntrypoints:    false,
+		NpmLabelSuffix:     "{name}",
+		FirstParty:         make(map[string]label.Label),
+		DirImportFallback:  "error",
+		WorkspacePackages:  make(map[string]bool),
+		PackageType:        "",
+		GenruleOuts:        false,
+		CollectAllKinds:    map[string]bool{"ts_project": true, "js_library": true},
+		ExtensionPriority:  []string{},
+		MaxDepsWarn:        -1,
+		EntryFields:        []string{},
+		PackageEntries:     make(map[string]string),
+		ProjectReferences:  []string{},
+		ResolveFromRoot:    false,
+		QuietRelative:      false,
+		OutDirs:            make(map[string]string),
+		IncludePkgFiles:    false,
+		IndexCoverage:      false,
+		BrowserMap:         false,
+		BrowserRemaps:      make(map[string]string),
+		ExpandTemplates:    false,
+		MocksDir:           "__mocks__",
+		DevDepRuntimeKinds: make(map[string]bool),
+		ResolveCache:       "",
+		DepCommentPattern:  nil,
+		GenSuffixes:        make(map[string]string),
+		CSSModuleTypes:     false,
+		VirtualPrefixes:    make(map[string]label.Label),
+		ExportConditions:   []string{},
+		PackageExportsRaw:  nil,
+		PackageImportsRaw:  nil,
+		FilesystemIndex:    false,
+		GraphExport:        "",
+		ExternalRepos:      make(map[string]string),
+		RootDirs:           []string{},
+		PreserveEmptyDeps:  make(map[string]bool),
+		CollectAllFallback: false,
+		RuleNameSuffixes:   []string{},
+		IgnoredSuffixes:    []string{},
+		DepPrecedence:      "deps-wins",
+		ContextAttr:        "",
+		Context:            "",
 	}
 }
 
@@ -175,6 +314,142 @@ func (parent *JsConfig) NewChild() *JsConfig {
 	child.Quiet = parent.Quiet
 	child.Verbose = parent.Verbose
 	child.DefaultNpmLabel = parent.DefaultNpmLabel
+	child.GeneratedBarrels = make(map[string]label.Label) // copy map
+	for k, v := range parent.GeneratedBarrels {
+		child.GeneratedBarrels[k] = v
+	}
+	child.PrintOnly = parent.PrintOnly
+	child.TypesMapping = make(map[string]string) // copy map
+	for k, v := range parent.TypesMapping {
+		child.TypesMapping[k] = v
+	}
+	child.IndexExclusions = make([]string, len(parent.IndexExclusions)) // copy slice
+	for i := range parent.IndexExclusions {
+		child.IndexExclusions[i] = parent.IndexExclusions[i]
+	}
+	child.ExclusionPattern = parent.ExclusionPattern // Regenerated on change to IndexExclusions
+	child.CaseInsensitive = parent.CaseInsensitive
+	child.BuiltinPolyfills = make(map[string]string) // copy map
+	for k, v := range parent.BuiltinPolyfills {
+		child.BuiltinPolyfills[k] = v
+	}
+	child.PackageLabel = parent.PackageLabel
+	child.ScopedPackageFiles = parent.ScopedPackageFiles
+	child.NoDataKinds = make(map[string]bool) // copy map
+	for k, v := range parent.NoDataKinds {
+		child.NoDataKinds[k] = v
+	}
+	child.BarrelPattern = parent.BarrelPattern
+	child.LabelStyle = parent.LabelStyle
+	child.ImportQueries = make(map[string]string) // copy map
+	for k, v := range parent.ImportQueries {
+		child.ImportQueries[k] = v
+	}
+	child.PackageName = parent.PackageName
+	child.PackageDir = parent.PackageDir
+	child.PackageExports = make(map[string]string) // copy map
+	for k, v := range parent.PackageExports {
+		child.PackageExports[k] = v
+	}
+	child.AmbientModules = make([]string, len(parent.AmbientModules)) // copy slice
+	for i := range parent.AmbientModules {
+		child.AmbientModules[i] = parent.AmbientModules[i]
+	}
+	child.AmbientPattern = parent.AmbientPattern              // Regenerated on change to AmbientModules
+	child.VendorDirs = make([]string, len(parent.VendorDirs)) // copy slice
+	for i := range parent.VendorDirs {
+		child.VendorDirs[i] = parent.VendorDirs[i]
+	}
+	child.AggregatorKinds = make(map[string]bool) // copy map
+	for k, v := range parent.AggregatorKinds {
+		child.AggregatorKinds[k] = v
+	}
+	child.NodeTypes = parent.NodeTypes
+	child.ImplicitDeps = make([]string, len(parent.ImplicitDeps)) // copy slice
+	for i := range parent.ImplicitDeps {
+		child.ImplicitDeps[i] = parent.ImplicitDeps[i]
+	}
+	child.Bundle = parent.Bundle
+	child.MetaResolve = parent.MetaResolve
+	child.NpmAliases = make(map[string]string) // copy map
+	for k, v := range parent.NpmAliases {
+		child.NpmAliases[k] = v
+	}
+	child.TypeDepsAttr = parent.TypeDepsAttr
+	child.HTMLEntrypoints = parent.HTMLEntrypoints
+	child.NpmLabelSuffix = parent.NpmLabelSuffix
+	child.FirstParty = make(map[string]label.Label) // copy map
+	for k, v := range parent.FirstParty {
+		child.FirstParty[k] = v
+	}
+	child.DirImportFallback = parent.DirImportFallback
+	child.WorkspacePackages = make(map[string]bool) // copy map
+	for k, v := range parent.WorkspacePackages {
+		child.WorkspacePackages[k] = v
+	}
+	child.PackageType = parent.PackageType
+	child.GenruleOuts = parent.GenruleOuts
+	child.CollectAllKinds = make(map[string]bool) // copy map
+	for k, v := range parent.CollectAllKinds {
+		child.CollectAllKinds[k] = v
+	}
+	child.ExtensionPriority = parent.ExtensionPriority
+	child.MaxDepsWarn = parent.MaxDepsWarn
+	child.EntryFields = parent.EntryFields
+	child.PackageEntries = make(map[string]string) // copy map
+	for k, v := range parent.PackageEntries {
+		child.PackageEntries[k] = v
+	}
+	child.ProjectReferences = parent.ProjectReferences
+	child.ResolveFromRoot = parent.ResolveFromRoot
+	child.QuietRelative = parent.QuietRelative
+	child.OutDirs = make(map[string]string) // copy map
+	for k, v := range parent.OutDirs {
+		child.OutDirs[k] = v
+	}
+	child.IncludePkgFiles = parent.IncludePkgFiles
+	child.IndexCoverage = parent.IndexCoverage
+	child.BrowserMap = parent.BrowserMap
+	child.BrowserRemaps = make(map[string]string) // copy map
+	for k, v := range parent.BrowserRemaps {
+		child.BrowserRemaps[k] = v
+	}
+	child.ExpandTemplates = parent.ExpandTemplates
+	child.MocksDir = parent.MocksDir
+	child.DevDepRuntimeKinds = make(map[string]bool) // copy map
+	for k, v := range parent.DevDepRuntimeKinds {
+		child.DevDepRuntimeKinds[k] = v
+	}
+	child.ResolveCache = parent.ResolveCache
+	child.DepCommentPattern = parent.DepCommentPattern
+	child.GenSuffixes = make(map[string]string) // copy map
+	for k, v := range parent.GenSuffixes {
+		child.GenSuffixes[k] = v
+	}
+	child.CSSModuleTypes = parent.CSSModuleTypes
+	child.VirtualPrefixes = make(map[string]label.Label) // copy map
+	for k, v := range parent.VirtualPrefixes {
+		child.VirtualPrefixes[k] = v
+	}
+	child.ExportConditions = parent.ExportConditions
+	child.PackageExportsRaw = parent.PackageExportsRaw
+	child.PackageImportsRaw = parent.PackageImportsRaw
+	child.FilesystemIndex = parent.FilesystemIndex
+	child.GraphExport = parent.GraphExport
+	for k, v := range parent.ExternalRepos {
+		child.ExternalRepos[k] = v
+	}
+	child.RootDirs = parent.RootDirs
+	child.PreserveEmptyDeps = make(map[string]bool) // copy map
+	for k, v := range parent.PreserveEmptyDeps {
+		child.PreserveEmptyDeps[k] = v
+	}
+	child.CollectAllFallback = parent.CollectAllFallback
+	child.RuleNameSuffixes = parent.RuleNameSuffixes
+	child.IgnoredSuffixes = parent.IgnoredSuffixes
+	child.DepPrecedence = parent.DepPrecedence
+	child.ContextAttr = parent.ContextAttr
+	child.Context = parent.Context
 
 	return child
 }
@@ -231,6 +506,63 @@ func (*JS) KnownDirectives() []string {
 		"js_quiet",
 		"js_verbose",
 		"js_default_npm_label",
+		"js_generated_barrel",
+		"js_print_only",
+		"js_types_mapping",
+		"js_exclude_from_index",
+		"js_case_insensitive",
+		"js_builtin_polyfill",
+		"js_alias_roots",
+		"js_scoped_package_files",
+		"js_no_data_kinds",
+		"js_barrel_files",
+		"js_label_style",
+		"js_import_query",
+		"js_ambient_declarations",
+		"js_vendor_dirs",
+		"js_aggregator_kinds",
+		"js_node_types",
+		"js_implicit_deps",
+		"js_bundle",
+		"js_import_meta_resolve",
+		"js_type_deps_attr",
+		"js_html_entrypoints",
+		"js_tsconfig_paths",
+		"js_npm_label_suffix",
+		"js_first_party",
+		"js_dir_import_fallback",
+		"js_index_genrule_outs",
+		"js_collect_all_kinds",
+		"js_extension_priority",
+		"js_max_deps_warn",
+		"js_entry_field",
+		"js_tsconfig_references",
+		"js_resolve_from_root",
+		"js_quiet_relative",
+		"js_outdir_map",
+		"js_include_pkg_files",
+		"js_index_coverage",
+		"js_browser_map",
+		"js_expand_template_imports",
+		"js_mocks_dir",
+		"js_devdep_runtime_kinds",
+		"js_resolve_cache",
+		"js_dep_comment_pattern",
+		"js_gen_suffix",
+		"js_css_module_types",
+		"js_virtual_prefix",
+		"js_export_conditions",
+		"js_filesystem_index",
+		"js_graph_export",
+		"js_external_repo",
+		"js_tsconfig_root_dirs",
+		"js_preserve_empty_deps",
+		"js_collect_all_fallback",
+		"js_rule_name_suffix",
+		"js_resolve_ignored_suffixes",
+		"js_dep_precedence",
+		"js_context_attr",
+		"js_context",
 	}
 }
 
@@ -245,7 +577,7 @@ func (*JS) KnownDirectives() []string {
 //
 // f is the build file for the current directory or nil if there is no
 // existing build file.
-func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
+func (lang *JS) Configure(c *config.Config, rel string, f *rule.File) {
 
 	// Create the root config.
 	if _, exists := c.Exts[languageName]; !exists {
@@ -266,6 +598,8 @@ func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
 		jsConfigs[rel] = jsConfig
 	}
 
+	packageFileRead := false
+
 	// Read directives from existing file
 	if f != nil {
 
@@ -286,6 +620,15 @@ func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
 			case "js_lookup_types":
 				jsConfig.LookupTypes = readBoolDirective(directive)
 
+			case "js_types_mapping":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected pkg=types_pkg", directive.Key, directive.Value))
+					}
+					jsConfig.TypesMapping[vals[0]] = vals[1]
+				}
+
 			case "js_fix":
 				jsConfig.Fix = readBoolDirective(directive)
 
@@ -295,51 +638,51 @@ func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
 					log.Fatalf(Err("failed to read directive %s: %s, expected 2 values", directive.Key, directive.Value))
 				}
 				jsConfig.PackageFile = values[0]
-				npmLabel := values[1]
-				if strings.HasPrefix(npmLabel, ":") {
-					npmLabel = labels.ParseRelative(npmLabel, f.Pkg).Format()
-				}
-				if !strings.HasSuffix(npmLabel, ":") && !strings.HasSuffix(npmLabel, "/") {
-					npmLabel += "/"
-				}
+				jsConfig.PackageLabel = values[1]
+				jsConfig.readPackageFile(lang.packageFiles, c.RepoRoot, f.Pkg)
+				packageFileRead = true
 
-				data, err := os.ReadFile(path.Join(c.RepoRoot, f.Pkg, jsConfig.PackageFile))
-				if err != nil {
-					log.Fatalf(Err("failed to open %s: %v", directive.Value, err))
-				}
+			case "js_import_alias":
+				vals := strings.SplitN(directive.Value, " ", 2)
+				jsConfig.ImportAliases = append(jsConfig.ImportAliases, struct{ From, To string }{From: vals[0], To: strings.TrimSpace(vals[1])})
 
-				// Read dependencies from file
-				newDeps := struct {
-					Dependencies    map[string]string "json:\"dependencies\""
-					DevDependencies map[string]string "json:\"devDependencies\""
-				}{
-					Dependencies:    make(map[string]string),
-					DevDependencies: make(map[string]string),
-				}
-				if err := json.Unmarshal(data, &newDeps); err != nil {
+				// Regenerate ImportAliasPattern
+				var err error
+				if jsConfig.ImportAliasPattern, err = importAliasPattern(jsConfig.ImportAliases); err != nil {
 					log.Fatalf(Err("failed to parse %s: %v", directive.Value, err))
 				}
 
-				// Store npmLabel in dependencies
-				for k, _ := range newDeps.Dependencies {
-					jsConfig.NpmDependencies.Dependencies[k] = npmLabel
-				}
-				for k, _ := range newDeps.DevDependencies {
-					jsConfig.NpmDependencies.DevDependencies[k] = npmLabel
+			case "js_alias_roots":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected alias=root", directive.Key, directive.Value))
+					}
+					// roots are relative to the package declaring them
+					root := path.Join(f.Pkg, vals[1])
+					if root == "." {
+						root = ""
+					} else {
+						root += "/"
+					}
+					jsConfig.ImportAliases = append(jsConfig.ImportAliases, struct{ From, To string }{From: vals[0], To: root})
 				}
 
-			case "js_import_alias":
-				vals := strings.SplitN(directive.Value, " ", 2)
-				jsConfig.ImportAliases = append(jsConfig.ImportAliases, struct{ From, To string }{From: vals[0], To: strings.TrimSpace(vals[1])})
-
 				// Regenerate ImportAliasPattern
-				keyPatterns := make([]string, 0, len(jsConfig.ImportAliases))
-				for _, alias := range jsConfig.ImportAliases {
-					keyPatterns = append(keyPatterns, fmt.Sprintf("(^%s)", regexp.QuoteMeta(alias.From)))
+				var err error
+				if jsConfig.ImportAliasPattern, err = importAliasPattern(jsConfig.ImportAliases); err != nil {
+					log.Fatalf(Err("failed to parse %s: %v", directive.Value, err))
+				}
+
+			case "js_exclude_from_index":
+				for _, glob := range strings.Split(directive.Value, ",") {
+					// globs are relative to the package declaring them
+					jsConfig.IndexExclusions = append(jsConfig.IndexExclusions, path.Join(f.Pkg, strings.TrimSpace(glob)))
 				}
 
+				// Regenerate ExclusionPattern
 				var err error
-				if jsConfig.ImportAliasPattern, err = regexp.Compile(strings.Join(keyPatterns, "|")); err != nil {
+				if jsConfig.ExclusionPattern, err = globPattern(jsConfig.IndexExclusions); err != nil {
 					log.Fatalf(Err("failed to parse %s: %v", directive.Value, err))
 				}
 
@@ -351,6 +694,17 @@ func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
 					jsConfig.DefaultNpmLabel += "/"
 				}
 
+			case "js_generated_barrel":
+				lbl, err := label.Parse(directive.Value)
+				if err != nil {
+					log.Fatalf(Err("failed to read directive %s: %v", directive.Key, err))
+				}
+				if lbl.Relative {
+					lbl.Pkg = f.Pkg
+					lbl.Relative = false
+				}
+				jsConfig.GeneratedBarrels[lbl.Pkg] = lbl
+
 			case "js_root":
 				jSRoot, err := filepath.Rel(".", f.Pkg)
 				if err != nil {
@@ -418,14 +772,743 @@ func (*JS) Configure(c *config.Config, rel string, f *rule.File) {
 					jsConfig.Verbose = false
 				}
 
+			case "js_print_only":
+				jsConfig.PrintOnly = readBoolDirective(directive)
+
 			case "js_verbose":
 				jsConfig.Verbose = readBoolDirective(directive)
 				if jsConfig.Verbose {
 					jsConfig.Quiet = false
 				}
+
+			case "js_case_insensitive":
+				jsConfig.CaseInsensitive = readBoolDirective(directive)
+
+			case "js_builtin_polyfill":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected builtin=pkg", directive.Key, directive.Value))
+					}
+					jsConfig.BuiltinPolyfills[vals[0]] = vals[1]
+				}
+
+			case "js_scoped_package_files":
+				jsConfig.ScopedPackageFiles = readBoolDirective(directive)
+
+			case "js_no_data_kinds":
+				for _, kind := range strings.Split(directive.Value, ",") {
+					jsConfig.NoDataKinds[strings.TrimSpace(kind)] = true
+				}
+
+			case "js_barrel_files":
+				names := strings.Split(directive.Value, ",")
+				for i := range names {
+					names[i] = strings.TrimSpace(names[i])
+				}
+				jsConfig.BarrelPattern = barrelFilePattern(names)
+
+			case "js_label_style":
+				switch directive.Value {
+				case "absolute", "relative":
+					jsConfig.LabelStyle = directive.Value
+				default:
+					log.Fatalf(Err("failed to read directive %s: %s, only \"absolute\", and \"relative\" are valid", directive.Key, directive.Value))
+				}
+
+			case "js_import_query":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || (vals[1] != "dep" && vals[1] != "data") {
+						log.Fatalf(Err("failed to read directive %s: %s, expected query=dep or query=data", directive.Key, directive.Value))
+					}
+					jsConfig.ImportQueries[vals[0]] = vals[1]
+				}
+
+			case "js_ambient_declarations":
+				for _, declarations := range strings.Split(directive.Value, ",") {
+					// declaration files are relative to the package declaring them
+					declarationsFile := path.Join(c.RepoRoot, f.Pkg, strings.TrimSpace(declarations))
+					data, err := os.ReadFile(declarationsFile)
+					if err != nil {
+						log.Fatalf(Err("failed to open %s: %v", declarationsFile, err))
+					}
+					modules, err := ParseDeclaredModules(data)
+					if err != nil {
+						log.Fatalf(Err("failed to parse %s: %v", declarationsFile, err))
+					}
+					jsConfig.AmbientModules = append(jsConfig.AmbientModules, modules...)
+				}
+
+				// Regenerate AmbientPattern
+				jsConfig.AmbientPattern = ambientModulePattern(jsConfig.AmbientModules)
+
+			case "js_vendor_dirs":
+				for _, dir := range strings.Split(directive.Value, ",") {
+					// vendor dirs are relative to the package declaring them
+					jsConfig.VendorDirs = append(jsConfig.VendorDirs, path.Join(f.Pkg, strings.TrimSpace(dir)))
+				}
+
+			case "js_aggregator_kinds":
+				for _, kind := range strings.Split(directive.Value, ",") {
+					jsConfig.AggregatorKinds[strings.TrimSpace(kind)] = true
+				}
+
+			case "js_node_types":
+				jsConfig.NodeTypes = readBoolDirective(directive)
+
+			case "js_implicit_deps":
+				// an empty value clears the inherited implicit deps
+				jsConfig.ImplicitDeps = []string{}
+				for _, dep := range strings.Split(directive.Value, ",") {
+					if dep = strings.TrimSpace(dep); dep != "" {
+						jsConfig.ImplicitDeps = append(jsConfig.ImplicitDeps, dep)
+					}
+				}
+
+			case "js_bundle":
+				// an empty value opts out of the inherited bundle
+				jsConfig.Bundle = label.NoLabel
+				if directive.Value != "" {
+					lbl, err := label.Parse(directive.Value)
+					if err != nil {
+						log.Fatalf(Err("failed to read directive %s: %v", directive.Key, err))
+					}
+					if lbl.Relative {
+						lbl.Pkg = f.Pkg
+						lbl.Relative = false
+					}
+					jsConfig.Bundle = lbl
+				}
+
+			case "js_import_meta_resolve":
+				if directive.Value != "dep" && directive.Value != "data" {
+					log.Fatalf(Err("failed to read directive %s: %s, expected dep or data", directive.Key, directive.Value))
+				}
+				jsConfig.MetaResolve = directive.Value
+
+			case "js_type_deps_attr":
+				jsConfig.TypeDepsAttr = directive.Value
+				if directive.Value != "" {
+					lang.addResolveAttr("ts_project", directive.Value)
+				}
+
+			case "js_html_entrypoints":
+				jsConfig.HTMLEntrypoints = readBoolDirective(directive)
+
+			case "js_tsconfig_paths":
+				configFile := directive.Value
+				if configFile == "" {
+					// plain js projects use a jsconfig.json of the same shape
+					configFile = "tsconfig.json"
+					if _, err := os.Stat(path.Join(c.RepoRoot, f.Pkg, configFile)); err != nil {
+						configFile = "jsconfig.json"
+					}
+				}
+				jsConfig.readConfigPaths(c.RepoRoot, f.Pkg, configFile)
+
+				// Regenerate ImportAliasPattern
+				var err error
+				if jsConfig.ImportAliasPattern, err = importAliasPattern(jsConfig.ImportAliases); err != nil {
+					log.Fatalf(Err("failed to parse %s: %v", directive.Value, err))
+				}
+
+			case "js_npm_label_suffix":
+				if !strings.Contains(directive.Value, "{name}") {
+					log.Fatalf(Err("failed to read directive %s: %s, expected a template containing {name}", directive.Key, directive.Value))
+				}
+				jsConfig.NpmLabelSuffix = directive.Value
+
+			case "js_first_party":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected name=label", directive.Key, directive.Value))
+					}
+					lbl, err := label.Parse(vals[1])
+					if err != nil {
+						log.Fatalf(Err("failed to read directive %s: %v", directive.Key, err))
+					}
+					if lbl.Relative {
+						lbl.Pkg = f.Pkg
+						lbl.Relative = false
+					}
+					jsConfig.FirstParty[vals[0]] = lbl
+				}
+
+			case "js_dir_import_fallback":
+				switch directive.Value {
+				case "error", "filegroup", "glob":
+					jsConfig.DirImportFallback = directive.Value
+				default:
+					log.Fatalf(Err("failed to read directive %s: %s, expected filegroup, error or glob", directive.Key, directive.Value))
+				}
+
+			case "js_index_genrule_outs":
+				jsConfig.GenruleOuts = readBoolDirective(directive)
+
+			case "js_collect_all_kinds":
+				jsConfig.CollectAllKinds = make(map[string]bool)
+				for _, kind := range strings.Split(directive.Value, ",") {
+					if kind = strings.TrimSpace(kind); kind != "" {
+						jsConfig.CollectAllKinds[kind] = true
+					}
+				}
+
+			case "js_extension_priority":
+				jsConfig.ExtensionPriority = []string{}
+				for _, lang := range strings.Split(directive.Value, ",") {
+					lang = strings.TrimSpace(lang)
+					if lang != "ts" && lang != "js" {
+						log.Fatalf(Err("failed to read directive %s: unknown extension %q, expected ts or js", directive.Key, lang))
+					}
+					jsConfig.ExtensionPriority = append(jsConfig.ExtensionPriority, lang)
+				}
+
+			case "js_max_deps_warn":
+				jsConfig.MaxDepsWarn = readIntDirective(directive)
+
+			case "js_entry_field":
+				jsConfig.EntryFields = []string{}
+				for _, field := range strings.Split(directive.Value, ",") {
+					if field = strings.TrimSpace(field); field != "" {
+						jsConfig.EntryFields = append(jsConfig.EntryFields, field)
+					}
+				}
+
+			case "js_tsconfig_references":
+				configFile := directive.Value
+				if configFile == "" {
+					configFile = "tsconfig.json"
+				}
+				jsConfig.readProjectReferences(c.RepoRoot, f.Pkg, configFile)
+
+			case "js_resolve_from_root":
+				jsConfig.ResolveFromRoot = readBoolDirective(directive)
+
+			case "js_quiet_relative":
+				jsConfig.QuietRelative = readBoolDirective(directive)
+
+			case "js_outdir_map":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected outdir=srcdir", directive.Key, directive.Value))
+					}
+					jsConfig.OutDirs[normalizePath(f.Pkg, vals[0])] = normalizePath(f.Pkg, vals[1])
+				}
+
+			case "js_include_pkg_files":
+				jsConfig.IncludePkgFiles = readBoolDirective(directive)
+
+			case "js_index_coverage":
+				jsConfig.IndexCoverage = readBoolDirective(directive)
+
+			case "js_browser_map":
+				jsConfig.BrowserMap = readBoolDirective(directive)
+
+			case "js_expand_template_imports":
+				jsConfig.ExpandTemplates = readBoolDirective(directive)
+
+			case "js_mocks_dir":
+				jsConfig.MocksDir = directive.Value
+
+			case "js_devdep_runtime_kinds":
+				for _, kind := range strings.Split(directive.Value, ",") {
+					jsConfig.DevDepRuntimeKinds[strings.TrimSpace(kind)] = true
+				}
+
+			case "js_resolve_cache":
+				jsConfig.ResolveCache = directive.Value
+
+			case "js_dep_comment_pattern":
+				if directive.Value == "" {
+					jsConfig.DepCommentPattern = nil
+					break
+				}
+				pattern, err := regexp.Compile(directive.Value)
+				if err != nil {
+					log.Fatalf(Err("failed to read directive %s: %v", directive.Key, err))
+				}
+				if pattern.NumSubexp() < 1 {
+					log.Fatalf(Err("failed to read directive %s: %s, expected a group capturing the import", directive.Key, directive.Value))
+				}
+				jsConfig.DepCommentPattern = pattern
+
+			case "js_gen_suffix":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || vals[1] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected suffix=lang", directive.Key, directive.Value))
+					}
+					jsConfig.GenSuffixes[vals[0]] = vals[1]
+				}
+
+			case "js_css_module_types":
+				jsConfig.CSSModuleTypes = readBoolDirective(directive)
+
+			case "js_virtual_prefix":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" {
+						log.Fatalf(Err("failed to read directive %s: %s, expected prefix=label", directive.Key, directive.Value))
+					}
+					if vals[1] == "" {
+						// an empty label skips the imports of the prefix
+						jsConfig.VirtualPrefixes[vals[0]] = label.NoLabel
+						continue
+					}
+					lbl, err := label.Parse(vals[1])
+					if err != nil {
+						log.Fatalf(Err("failed to read directive %s: %v", directive.Key, err))
+					}
+					if lbl.Relative {
+						lbl.Pkg = f.Pkg
+						lbl.Relative = false
+					}
+					jsConfig.VirtualPrefixes[vals[0]] = lbl
+				}
+
+			case "js_export_conditions":
+				jsConfig.ExportConditions = []string{}
+				for _, condition := range strings.Split(directive.Value, ",") {
+					if condition = strings.TrimSpace(condition); condition != "" {
+						jsConfig.ExportConditions = append(jsConfig.ExportConditions, condition)
+					}
+				}
+
+			case "js_filesystem_index":
+				jsConfig.FilesystemIndex = readBoolDirective(directive)
+
+			case "js_graph_export":
+				jsConfig.GraphExport = directive.Value
+
+			case "js_external_repo":
+				for _, mapping := range strings.Split(directive.Value, ",") {
+					vals := strings.SplitN(strings.TrimSpace(mapping), "=", 2)
+					if len(vals) != 2 || vals[0] == "" || !strings.HasPrefix(vals[1], "@") || !strings.Contains(vals[1], "//") {
+						log.Fatalf(Err("failed to read directive %s: %s, expected prefix=@repo//package", directive.Key, directive.Value))
+					}
+					jsConfig.ExternalRepos[vals[0]] = vals[1]
+				}
+
+			case "js_tsconfig_root_dirs":
+				configFile := directive.Value
+				if configFile == "" {
+					configFile = "tsconfig.json"
+				}
+				jsConfig.readRootDirs(c.RepoRoot, f.Pkg, configFile)
+
+			case "js_preserve_empty_deps":
+				for _, kind := range strings.Split(directive.Value, ",") {
+					if kind = strings.TrimSpace(kind); kind != "" {
+						jsConfig.PreserveEmptyDeps[kind] = true
+					}
+				}
+
+			case "js_collect_all_fallback":
+				jsConfig.CollectAllFallback = readBoolDirective(directive)
+
+			case "js_rule_name_suffix":
+				jsConfig.RuleNameSuffixes = []string{}
+				for _, suffix := range strings.Split(directive.Value, ",") {
+					if suffix = strings.TrimSpace(suffix); suffix != "" {
+						jsConfig.RuleNameSuffixes = append(jsConfig.RuleNameSuffixes, suffix)
+					}
+				}
+
+			case "js_resolve_ignored_suffixes":
+				jsConfig.IgnoredSuffixes = []string{}
+				for _, suffix := range strings.Split(directive.Value, ",") {
+					if suffix = strings.TrimSpace(suffix); suffix != "" {
+						jsConfig.IgnoredSuffixes = append(jsConfig.IgnoredSuffixes, suffix)
+					}
+				}
+
+			case "js_dep_precedence":
+				switch directive.Value {
+				case "deps-wins", "devdeps-wins":
+					jsConfig.DepPrecedence = directive.Value
+				default:
+					log.Fatalf(Err("failed to read directive %s: %s, expected deps-wins or devdeps-wins", directive.Key, directive.Value))
+				}
+
+			case "js_context_attr":
+				jsConfig.ContextAttr = directive.Value
+
+			case "js_context":
+				jsConfig.Context = directive.Value
+			}
+		}
+	}
+
+	// Scope npm dependencies to the nearest package file
+	if jsConfig.ScopedPackageFiles && jsConfig.PackageLabel != "" && !packageFileRead {
+		if _, err := os.Stat(path.Join(c.RepoRoot, rel, jsConfig.PackageFile)); err == nil {
+			jsConfig.readPackageFile(lang.packageFiles, c.RepoRoot, rel)
+			packageFileRead = true
+		}
+	}
+
+	// workspace packages are imported by name from the other packages
+	if packageFileRead && jsConfig.PackageName != "" && normalizePath(jsConfig.PackageDir) == rel {
+		if _, ok := lang.workspaceDirs[jsConfig.PackageName]; !ok {
+			lang.workspaceDirs[jsConfig.PackageName] = rel
+		}
+	}
+
+	// cached resolutions are only valid for the same configuration
+	if jsConfig.ResolveCache != "" {
+		if f != nil {
+			for _, directive := range f.Directives {
+				lang.cache.addInput(fmt.Sprintf("directive %s %s %s", rel, directive.Key, directive.Value))
+			}
+		}
+		if data, err := json.Marshal(jsConfig); err == nil {
+			lang.cache.addInput(fmt.Sprintf("config %s %s", rel, data))
+		}
+	}
+}
+
+// readPackageFile stores the npm dependencies declared by the package file in
+// pkg, parsed through files. Relative npm labels are resolved against pkg.
+func (jsConfig *JsConfig) readPackageFile(files *packageFileCache, repoRoot string, pkg string) {
+	npmLabel := jsConfig.PackageLabel
+	if strings.HasPrefix(npmLabel, ":") {
+		npmLabel = labels.ParseRelative(npmLabel, pkg).Format()
+	}
+	if !strings.HasSuffix(npmLabel, ":") && !strings.HasSuffix(npmLabel, "/") {
+		npmLabel += "/"
+	}
+
+	packageFile := path.Join(repoRoot, pkg, jsConfig.PackageFile)
+	newDeps, err := files.load(packageFile)
+	if err != nil {
+		log.Fatalf(Err("failed to read %s: %v", packageFile, err))
+	}
+
+	// Store the package's own name so it can import itself
+	jsConfig.PackageName = newDeps.Name
+	jsConfig.PackageType = newDeps.Type
+	jsConfig.PackageDir = path.Dir(path.Join(pkg, jsConfig.PackageFile))
+	jsConfig.PackageExports = readPackageExports(newDeps.Exports, nil)
+	jsConfig.PackageExportsRaw = newDeps.Exports
+	jsConfig.PackageImportsRaw = newDeps.Imports
+	if _, ok := jsConfig.PackageExports["."]; !ok && newDeps.Main != "" && !hasExports(jsConfig) {
+		jsConfig.PackageExports["."] = newDeps.Main
+	}
+
+	// Store the entry points, selected by the js_entry_field of importers.
+	// Only the string form of "browser" names an entry point.
+	jsConfig.PackageEntries = make(map[string]string)
+	var browser string
+	if json.Unmarshal(newDeps.Browser, &browser) != nil {
+		browser = ""
+	}
+	types := newDeps.Types
+	if types == "" {
+		types = newDeps.Typings
+	}
+
+	// The object form of "browser" remaps files and packages for js_browser_map
+	jsConfig.BrowserRemaps = readBrowserRemaps(newDeps.Browser, jsConfig.PackageDir)
+	for field, entry := range map[string]string{"main": newDeps.Main, "module": newDeps.Module, "browser": browser, "types": types} {
+		if entry != "" {
+			jsConfig.PackageEntries[field] = entry
+		}
+	}
+
+	// Store npmLabel in dependencies
+	for _, k := range newDeps.dependencies {
+		jsConfig.NpmDependencies.Dependencies[k] = npmLabel
+	}
+	for _, k := range newDeps.devDependencies {
+		jsConfig.NpmDependencies.DevDependencies[k] = npmLabel
+	}
+	for _, k := range newDeps.workspace {
+		jsConfig.WorkspacePackages[k] = true
+	}
+	for k, pkg := range newDeps.aliases {
+		jsConfig.NpmAliases[k] = pkg
+	}
+}
+
+// readBrowserRemaps reads the object form of the "browser" field of a
+// package.json in dir, like {"./node.js": "./browser.js", "fs": false}.
+// Files are keyed by their path without extension, and excluded modules map
+// to "".
+func readBrowserRemaps(raw json.RawMessage, dir string) map[string]string {
+	remaps := make(map[string]string)
+	fields := make(map[string]json.RawMessage)
+	if json.Unmarshal(raw, &fields) != nil {
+		return remaps
+	}
+	for from, rawTo := range fields {
+		var to string
+		if json.Unmarshal(rawTo, &to) != nil {
+			// false excludes the module
+			var include bool
+			if json.Unmarshal(rawTo, &include) != nil || include {
+				continue
+			}
+		}
+		if strings.HasPrefix(from, ".") {
+			from = trimSourceExtension(path.Join(dir, from))
+		}
+		remaps[from] = to
+	}
+	return remaps
+}
+
+// npmAlias returns the package installed by an aliased dependency version,
+// like "react" for "npm:react@^18"
+func npmAlias(version string) (string, bool) {
+	if !strings.HasPrefix(version, "npm:") {
+		return "", false
+	}
+	pkg := strings.TrimPrefix(version, "npm:")
+	if i := strings.LastIndex(pkg, "@"); i > 0 {
+		pkg = pkg[:i]
+	}
+	return pkg, pkg != ""
+}
+
+// readProjectReferences stores the directories of the projects referenced by
+// a tsconfig.json file in pkg, like {"references": [{"path": "../shared"}]}.
+// References may name the directory of a project or its tsconfig file.
+func (jsConfig *JsConfig) readProjectReferences(repoRoot string, pkg string, configFile string) {
+	configPath := path.Join(repoRoot, pkg, configFile)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		log.Fatalf(Err("failed to open %s: %v", configPath, err))
+	}
+
+	tsconfig := struct {
+		References []struct {
+			Path string "json:\"path\""
+		} "json:\"references\""
+	}{}
+	if err := json.Unmarshal(stripJSONComments(data), &tsconfig); err != nil {
+		log.Fatalf(Err("failed to parse %s: %v", configPath, err))
+	}
+
+	jsConfig.ProjectReferences = make([]string, 0, len(tsconfig.References))
+	for _, reference := range tsconfig.References {
+		dir := path.Join(pkg, path.Dir(configFile), reference.Path)
+		if strings.HasSuffix(dir, ".json") {
+			dir = path.Dir(dir)
+		}
+		jsConfig.ProjectReferences = append(jsConfig.ProjectReferences, normalizePath(dir))
+	}
+}
+
+// readRootDirs stores the directories merged by the compilerOptions.rootDirs
+// of a tsconfig.json file in pkg, like ["src", "generated/src"].
+func (jsConfig *JsConfig) readRootDirs(repoRoot string, pkg string, configFile string) {
+	configPath := path.Join(repoRoot, pkg, configFile)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		log.Fatalf(Err("failed to open %s: %v", configPath, err))
+	}
+
+	tsconfig := struct {
+		CompilerOptions struct {
+			RootDirs []string "json:\"rootDirs\""
+		} "json:\"compilerOptions\""
+	}{}
+	if err := json.Unmarshal(stripJSONComments(data), &tsconfig); err != nil {
+		log.Fatalf(Err("failed to parse %s: %v", configPath, err))
+	}
+
+	jsConfig.RootDirs = make([]string, 0, len(tsconfig.CompilerOptions.RootDirs))
+	for _, dir := range tsconfig.CompilerOptions.RootDirs {
+		jsConfig.RootDirs = append(jsConfig.RootDirs, normalizePath(pkg, path.Dir(configFile), dir))
+	}
+}
+
+// readConfigPaths adds an import alias for each wildcard mapping of the
+// compilerOptions.paths of a tsconfig.json or jsconfig.json file in pkg, like
+// "@app/*": ["src/app/*"]. Targets are relative to compilerOptions.baseUrl.
+func (jsConfig *JsConfig) readConfigPaths(repoRoot string, pkg string, configFile string) {
+	configPath := path.Join(repoRoot, pkg, configFile)
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		log.Fatalf(Err("failed to open %s: %v", configPath, err))
+	}
+
+	tsconfig := struct {
+		CompilerOptions struct {
+			BaseURL string              "json:\"baseUrl\""
+			Paths   map[string][]string "json:\"paths\""
+		} "json:\"compilerOptions\""
+	}{}
+	if err := json.Unmarshal(stripJSONComments(data), &tsconfig); err != nil {
+		log.Fatalf(Err("failed to parse %s: %v", configPath, err))
+	}
+
+	// like in TypeScript, the longest matching prefix wins
+	patterns := make([]string, 0, len(tsconfig.CompilerOptions.Paths))
+	for pattern := range tsconfig.CompilerOptions.Paths {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+
+	for _, pattern := range patterns {
+		from := strings.TrimSuffix(pattern, "*")
+		if from == pattern || from == "" {
+			// only prefix mappings can be expressed as aliases
+			continue
+		}
+		for _, target := range tsconfig.CompilerOptions.Paths[pattern] {
+			root := path.Join(pkg, tsconfig.CompilerOptions.BaseURL, strings.TrimSuffix(target, "*"))
+			if root == "." {
+				root = ""
+			} else if strings.HasSuffix(target, "/*") || strings.HasSuffix(from, "/") {
+				root += "/"
+			}
+			jsConfig.ImportAliases = append(jsConfig.ImportAliases, struct{ From, To string }{From: from, To: root})
+		}
+	}
+}
+
+// stripJSONComments removes the comments and trailing commas that
+// tsconfig.json and jsconfig.json files allow from data.
+func stripJSONComments(data []byte) []byte {
+	stripped := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		switch {
+		case inString:
+			stripped = append(stripped, data[i])
+			if data[i] == '\\' && i+1 < len(data) {
+				i++
+				stripped = append(stripped, data[i])
+			} else if data[i] == '"' {
+				inString = false
+			}
+		case data[i] == '"':
+			inString = true
+			stripped = append(stripped, data[i])
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			i--
+		case data[i] == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return stripped
+			}
+			i += end + 3
+		case data[i] == ']' || data[i] == '}':
+			// drop a trailing comma before the closing bracket
+			trimmed := bytes.TrimRight(stripped, " \t\r\n")
+			if len(trimmed) > 0 && trimmed[len(trimmed)-1] == ',' {
+				stripped = append(trimmed[:len(trimmed)-1], stripped[len(trimmed):]...)
+			}
+			stripped = append(stripped, data[i])
+		default:
+			stripped = append(stripped, data[i])
+		}
+	}
+	return stripped
+}
+
+// exportConditions are the conditions of an "exports" entry that may point
+// at sources, in order of preference
+var exportConditions = []string{"types", "import", "default", "require"}
+
+// readPackageExports flattens the "exports" field of a package.json into a
+// map of subpaths, like "./utils", to the file they export, selected by the
+// active conditions of js_export_conditions when there are any. Subpaths
+// blocked with null map to "".
+func readPackageExports(raw json.RawMessage, conditions []string) map[string]string {
+	exports := make(map[string]string)
+	if len(raw) == 0 {
+		return exports
+	}
+
+	subpaths := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &subpaths); err != nil {
+		// "exports": "./index.js"
+		if target := exportTarget(raw, conditions); target != "" {
+			exports["."] = target
+		}
+		return exports
+	}
+	for subpath, value := range subpaths {
+		if !strings.HasPrefix(subpath, ".") {
+			// "exports": {"import": "./index.js"}
+			if target := exportTarget(raw, conditions); target != "" {
+				exports["."] = target
+			}
+			return exports
+		}
+		if target := exportTarget(value, conditions); target != "" {
+			exports[subpath] = target
+		} else if string(bytes.TrimSpace(value)) == "null" {
+			// "./internal/*": null blocks the subpath
+			exports[subpath] = ""
+		}
+	}
+	return exports
+}
+
+// readPackageImports flattens the "imports" field of a package.json into a
+// map of subpath imports, like "#internal/*", to their target, selected by the
+// active conditions like the "exports"
+func readPackageImports(raw json.RawMessage, conditions []string) map[string]string {
+	imports := make(map[string]string)
+	entries := make(map[string]json.RawMessage)
+	if len(raw) == 0 || json.Unmarshal(raw, &entries) != nil {
+		return imports
+	}
+	for subpath, value := range entries {
+		if !strings.HasPrefix(subpath, "#") {
+			continue
+		}
+		if target := exportTarget(value, conditions); target != "" {
+			imports[subpath] = target
+		}
+	}
+	return imports
+}
+
+// exportTarget returns the file an "exports" entry points at, following
+// nested conditions and fallback arrays. The active conditions are preferred
+// in order, then the exportConditions. Other conditions, like "node" or
+// "browser", are never followed unless they are active.
+func exportTarget(raw json.RawMessage, conditions []string) string {
+	var target string
+	if err := json.Unmarshal(raw, &target); err == nil {
+		return target
+	}
+	var fallbacks []json.RawMessage
+	if err := json.Unmarshal(raw, &fallbacks); err == nil {
+		for _, value := range fallbacks {
+			if target := exportTarget(value, conditions); target != "" {
+				return target
+			}
+		}
+		return ""
+	}
+	entries := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return ""
+	}
+	for _, condition := range append(append([]string{}, conditions...), exportConditions...) {
+		if value, ok := entries[condition]; ok {
+			if target := exportTarget(value, conditions); target != "" {
+				return target
 			}
 		}
 	}
+	return ""
 }
 
 var jsTestExtensions = []string{
@@ -448,15 +1531,45 @@ var jsExtensions = []string{
 	".jsx",
 }
 
+// jsModuleExtensions are the extensions of js files with an explicit module
+// format, which are only collected, not tried when resolving imports
+var jsModuleExtensions = []string{
+	".mjs",
+	".cjs",
+}
+
+var mdxExtensions = []string{
+	".mdx",
+}
+
+var htmlExtensions = []string{
+	".html",
+}
+
+var stylesheetExtensions = []string{
+	".css",
+	".scss",
+	".sass",
+	".less",
+}
+
 var jsTestExtensionsPattern *regexp.Regexp
 var tsTestExtensionsPattern *regexp.Regexp
 var tsExtensionsPattern *regexp.Regexp
 var jsExtensionsPattern *regexp.Regexp
+var jsModuleExtensionsPattern *regexp.Regexp
+var mdxExtensionsPattern *regexp.Regexp
+var htmlExtensionsPattern *regexp.Regexp
+var stylesheetExtensionsPattern *regexp.Regexp
 
 func init() { tsTestExtensionsPattern = extensionPattern(tsTestExtensions) }
 func init() { jsTestExtensionsPattern = extensionPattern(jsTestExtensions) }
 func init() { tsExtensionsPattern = extensionPattern(tsExtensions) }
 func init() { jsExtensionsPattern = extensionPattern(jsExtensions) }
+func init() { jsModuleExtensionsPattern = extensionPattern(jsModuleExtensions) }
+func init() { mdxExtensionsPattern = extensionPattern(mdxExtensions) }
+func init() { htmlExtensionsPattern = extensionPattern(htmlExtensions) }
+func init() { stylesheetExtensionsPattern = extensionPattern(stylesheetExtensions) }
 
 func extensionPattern(extensions []string) *regexp.Regexp {
 	escaped := make([]string, len(extensions))
@@ -466,20 +1579,94 @@ func extensionPattern(extensions []string) *regexp.Regexp {
 	return regexp.MustCompile(strings.Join(escaped, "|"))
 }
 
+// importAliasPattern compiles a pattern matching the prefix of any of the
+// import aliases.
+func importAliasPattern(aliases []struct{ From, To string }) (*regexp.Regexp, error) {
+	keyPatterns := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		keyPatterns = append(keyPatterns, fmt.Sprintf("(^%s)", regexp.QuoteMeta(alias.From)))
+	}
+	return regexp.Compile(strings.Join(keyPatterns, "|"))
+}
+
+// ambientModulePattern compiles the names of ambient module declarations into
+// a single pattern. Like in TypeScript, "*" matches any characters.
+func ambientModulePattern(modules []string) *regexp.Regexp {
+	patterns := make([]string, len(modules))
+	for i, module := range modules {
+		prefix, suffix, found := strings.Cut(module, "*")
+		if found {
+			patterns[i] = fmt.Sprintf("(^%s.*%s$)", regexp.QuoteMeta(prefix), regexp.QuoteMeta(suffix))
+		} else {
+			patterns[i] = fmt.Sprintf("(^%s$)", regexp.QuoteMeta(module))
+		}
+	}
+	if len(patterns) == 0 {
+		return regexp.MustCompile("$^")
+	}
+	return regexp.MustCompile(strings.Join(patterns, "|"))
+}
+
+// globPattern compiles a list of globs into a single pattern. "*" and "?"
+// match within a path segment, while "**" matches across path segments.
+func globPattern(globs []string) (*regexp.Regexp, error) {
+	patterns := make([]string, len(globs))
+	for i, glob := range globs {
+		var sb strings.Builder
+		for j := 0; j < len(glob); j++ {
+			switch {
+			case strings.HasPrefix(glob[j:], "**/"):
+				sb.WriteString("(?:.*/)?")
+				j += 2
+			case strings.HasPrefix(glob[j:], "**"):
+				sb.WriteString(".*")
+				j++
+			case glob[j] == '*':
+				sb.WriteString("[^/]*")
+			case glob[j] == '?':
+				sb.WriteString("[^/]")
+			default:
+				sb.WriteString(regexp.QuoteMeta(glob[j : j+1]))
+			}
+		}
+		patterns[i] = fmt.Sprintf("(^%s$)", sb.String())
+	}
+	return regexp.Compile(strings.Join(patterns, "|"))
+}
+
 var indexFilePattern *regexp.Regexp
 var trimExtPattern *regexp.Regexp
 var reactFilePattern *regexp.Regexp
 
-func init() {
+// barrelFilePattern matches files named after one of the barrel names, with
+// any of the ts or js extensions, but not files ending with one, like
+// myindex.ts.
+func barrelFilePattern(names []string) *regexp.Regexp {
+	escapedNames := make([]string, len(names))
+	for i, name := range names {
+		escapedNames[i] = regexp.QuoteMeta(name)
+	}
 	escaped := make([]string, len(tsExtensions)+len(jsExtensions))
 	for i, ext := range append(tsExtensions, jsExtensions...) {
 		escaped[i] = regexp.QuoteMeta(ext)
 	}
-	indexFilePattern = regexp.MustCompile(
-		fmt.Sprintf(`(index)(%s)$`,
+	return regexp.MustCompile(
+		fmt.Sprintf(`(?:^|/)(%s)(%s)$`,
+			strings.Join(escapedNames, "|"),
 			strings.Join(escaped, "|"),
 		),
 	)
+}
+
+func init() {
+	escaped := make([]string, len(tsExtensions)+len(jsExtensions))
+	for i, ext := range append(tsExtensions, jsExtensions...) {
+		escaped[i] = regexp.QuoteMeta(ext)
+	}
+	indexFilePattern = barrelFilePattern([]string{"index"})
+	for _, ext := range append(append(jsModuleExtensions, mdxExtensions...), htmlExtensions...) {
+		escaped = append(escaped, regexp.QuoteMeta(ext))
+	}
 	trimExtPattern = regexp.MustCompile(
 		fmt.Sprintf(`(\S+)(%s)$`,
 			strings.Join(escaped, "|"),
@@ -496,8 +1683,35 @@ func trimExt(baseName string) string {
 	return baseName
 }
 
-func isBarrelFile(baseName string) bool {
-	return indexFilePattern.MatchString(baseName) && !isReactFile(baseName)
+func isBarrelFile(jsConfig *JsConfig, baseName string) bool {
+	return jsConfig.BarrelPattern.MatchString(baseName) && !isReactFile(baseName)
+}
+
+// moduleFormat returns the module format of a plain js file, either from its
+// extension or from the "type" of its package.json. ts files and js files
+// without a declared type have no format.
+func moduleFormat(baseName string, packageType string) string {
+	switch {
+	case strings.HasSuffix(baseName, ".cjs"):
+		return formatCommonJS
+	case strings.HasSuffix(baseName, ".mjs"):
+		return formatModule
+	case strings.HasSuffix(baseName, ".js") && (packageType == formatCommonJS || packageType == formatModule):
+		return packageType
+	}
+	return formatAny
+}
+
+func isMDXFile(baseName string) bool {
+	return mdxExtensionsPattern.MatchString(baseName)
+}
+
+func isHTMLFile(baseName string) bool {
+	return htmlExtensionsPattern.MatchString(baseName)
+}
+
+func isStylesheetFile(baseName string) bool {
+	return stylesheetExtensionsPattern.MatchString(baseName)
 }
 
 func isReactFile(baseName string) bool {
@@ -0,0 +1,273 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestStripJSONComments(t *testing.T) {
+	data := `{
+  // line comment
+  "a": "http://example.com", /* block
+  comment */
+  "b": ["x", "y",],
+  "c": "quoted \" // not a comment",
+}`
+	var got map[string]interface{}
+	if err := json.Unmarshal(stripJSONComments([]byte(data)), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"a": "http://example.com",
+		"b": []interface{}{"x", "y"},
+		"c": `quoted " // not a comment`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+func TestTsconfigPaths(t *testing.T) {
+	for _, tc := range []struct {
+		desc  string
+		files map[string]string
+		want  []struct{ From, To string }
+	}{
+		{
+			desc: "jsconfig.json only",
+			files: map[string]string{
+				"web/jsconfig.json": `{"compilerOptions": {"baseUrl": ".", "paths": {"@lib/*": ["src/lib/*"]}}}`,
+			},
+			want: []struct{ From, To string }{{From: "@lib/", To: "web/src/lib/"}},
+		},
+		{
+			desc: "tsconfig.json wins",
+			files: map[string]string{
+				"web/jsconfig.json": `{"compilerOptions": {"paths": {"@js/*": ["js/*"]}}}`,
+				"web/tsconfig.json": `{
+  "compilerOptions": {
+    "baseUrl": "src",
+    "paths": {
+      "@app/*": ["app/*", "fallback/*"],
+      "@app/utils/*": ["utils/*"],
+      "exact": ["exact.ts"],
+    },
+  },
+}`,
+			},
+			want: []struct{ From, To string }{
+				{From: "@app/utils/", To: "web/src/utils/"},
+				{From: "@app/", To: "web/src/app/"},
+				{From: "@app/", To: "web/src/fallback/"},
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			for name, content := range tc.files {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lang := NewLanguage()
+			c := config.New()
+			c.RepoRoot = repoRoot
+			lang.Configure(c, "", nil)
+			lang.Configure(c, "web", &rule.File{Pkg: "web", Directives: []rule.Directive{{Key: "js_tsconfig_paths"}}})
+
+			jsConfig := c.Exts[languageName].(JsConfigs)["web"]
+			if !reflect.DeepEqual(jsConfig.ImportAliases, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.ImportAliases, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadPackageExportsConditions(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		exports    string
+		conditions []string
+		want       map[string]string
+	}{
+		{
+			name:    "import and require",
+			exports: `{"import": "./esm/index.js", "require": "./cjs/index.js"}`,
+			want:    map[string]string{".": "./esm/index.js"},
+		},
+		{
+			name:    "default only",
+			exports: `{"default": "./index.js"}`,
+			want:    map[string]string{".": "./index.js"},
+		},
+		{
+			name:    "require only",
+			exports: `{"require": "./cjs/index.js"}`,
+			want:    map[string]string{".": "./cjs/index.js"},
+		},
+		{
+			name:    "other conditions",
+			exports: `{"node": {"import": "./node.mjs"}, "browser": "./browser.js"}`,
+			want:    map[string]string{},
+		},
+		{
+			name:    "fallback array",
+			exports: `{".": [{"worker": "./worker.js"}, "./index.js"]}`,
+			want:    map[string]string{".": "./index.js"},
+		},
+		{
+			name:       "active conditions",
+			exports:    `{"types": "./index.d.ts", "node": "./node.js", "browser": {"development": "./browser.dev.js", "default": "./browser.js"}}`,
+			conditions: []string{"browser", "production"},
+			want:       map[string]string{".": "./browser.js"},
+		},
+		{
+			name:       "active conditions priority",
+			exports:    `{".": {"development": "./dev.js", "production": "./prod.js"}}`,
+			conditions: []string{"production", "development"},
+			want:       map[string]string{".": "./prod.js"},
+		},
+		{
+			name:       "inactive conditions",
+			exports:    `{".": [{"worker": "./worker.js"}, "./index.js"], "./node": {"node": "./node.js"}}`,
+			conditions: []string{"browser"},
+			want:       map[string]string{".": "./index.js"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := readPackageExports([]byte(tc.exports), tc.conditions); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadPackageFileWorkspace(t *testing.T) {
+	repoRoot := t.TempDir()
+	data := `{
+  "dependencies": {"@myorg/shared": "workspace:*", "lodash": "^4.17.21"},
+  "devDependencies": {"utils-lib": "workspace:^1.0.0"}
+}`
+	if err := os.WriteFile(filepath.Join(repoRoot, "package.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsConfig := NewJsConfig()
+	jsConfig.PackageLabel = "@npm//"
+	jsConfig.readPackageFile(newPackageFileCache(), repoRoot, "")
+
+	if want := map[string]bool{"@myorg/shared": true, "utils-lib": true}; !reflect.DeepEqual(jsConfig.WorkspacePackages, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.WorkspacePackages, want)
+	}
+	if want := map[string]string{"lodash": "@npm//"}; !reflect.DeepEqual(jsConfig.NpmDependencies.Dependencies, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.NpmDependencies.Dependencies, want)
+	}
+	if len(jsConfig.NpmDependencies.DevDependencies) != 0 {
+		t.Errorf("expected no npm devDependencies, got %#v", jsConfig.NpmDependencies.DevDependencies)
+	}
+}
+
+func TestReadPackageFileEntries(t *testing.T) {
+	repoRoot := t.TempDir()
+	data := `{
+  "name": "@myorg/ui",
+  "main": "./dist/index.cjs",
+  "module": "./src/index.ts",
+  "browser": {"./src/node.ts": "./src/browser.ts"},
+  "typings": "./dist/index.d.ts"
+}`
+	if err := os.WriteFile(filepath.Join(repoRoot, "package.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsConfig := NewJsConfig()
+	jsConfig.readPackageFile(newPackageFileCache(), repoRoot, "")
+
+	want := map[string]string{"main": "./dist/index.cjs", "module": "./src/index.ts", "types": "./dist/index.d.ts"}
+	if !reflect.DeepEqual(jsConfig.PackageEntries, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.PackageEntries, want)
+	}
+}
+
+func TestReadPackageFileBrowserRemaps(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{
+  "browser": {"./src/node.js": "./src/browser.js", "module-a": "module-b", "module-c": false}
+}`
+	if err := os.WriteFile(filepath.Join(repoRoot, "web", "package.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsConfig := NewJsConfig()
+	jsConfig.readPackageFile(newPackageFileCache(), repoRoot, "web")
+
+	want := map[string]string{"web/src/node": "./src/browser.js", "module-a": "module-b", "module-c": ""}
+	if !reflect.DeepEqual(jsConfig.BrowserRemaps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.BrowserRemaps, want)
+	}
+}
+
+func TestReadProjectReferences(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "apps", "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{
+  // built before this project
+  "references": [
+    {"path": "../../libs/shared"},
+    {"path": "../../libs/ui/tsconfig.build.json"}
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(repoRoot, "apps", "web", "tsconfig.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jsConfig := NewJsConfig()
+	jsConfig.readProjectReferences(repoRoot, "apps/web", "tsconfig.json")
+
+	if want := []string{"libs/shared", "libs/ui"}; !reflect.DeepEqual(jsConfig.ProjectReferences, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", jsConfig.ProjectReferences, want)
+	}
+}
+
+func TestBarrelFilePattern(t *testing.T) {
+	pattern := barrelFilePattern([]string{"index", "public-api"})
+	for name, want := range map[string]bool{
+		"index.ts":             true,
+		"public-api.js":        true,
+		"lib/index.tsx":        true,
+		"myindex.ts":           false,
+		"lib/my-public-api.ts": false,
+		"index.css":            false,
+	} {
+		if got := pattern.MatchString(name); got != want {
+			t.Errorf("barrelFilePattern.MatchString(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
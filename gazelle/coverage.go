@@ -0,0 +1,92 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// indexCoverage records the sources found while generating rules and the
+// sources indexed by Imports, so that js_index_coverage can report files no
+// rule makes importable.
+type indexCoverage struct {
+	mu       sync.Mutex
+	sources  map[string]bool
+	indexed  map[string]bool
+	empty    []string
+	reported bool
+}
+
+func newIndexCoverage() *indexCoverage {
+	return &indexCoverage{
+		sources: make(map[string]bool),
+		indexed: make(map[string]bool),
+	}
+}
+
+// addSource records a source file, relative to the repository root, that
+// should be importable.
+func (ic *indexCoverage) addSource(filePath string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.sources[filePath] = true
+}
+
+// addRule records the imports indexed for the rule named by ruleLabel. Rules
+// that index nothing are reported as empty.
+func (ic *indexCoverage) addRule(ruleLabel string, imps []string) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if len(imps) == 0 {
+		ic.empty = append(ic.empty, ruleLabel)
+	}
+	for _, imp := range imps {
+		ic.indexed[imp] = true
+	}
+}
+
+// report returns the coverage gaps, unindexed sources followed by empty
+// rules, the first time it is called and nil afterwards.
+func (ic *indexCoverage) report() []string {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.reported {
+		return nil
+	}
+	ic.reported = true
+
+	unindexed := make([]string, 0)
+	for source := range ic.sources {
+		if !ic.indexed[source] {
+			unindexed = append(unindexed, source)
+		}
+	}
+	sort.Strings(unindexed)
+	empty := append([]string{}, ic.empty...)
+	sort.Strings(empty)
+
+	gaps := make([]string, 0, len(unindexed)+len(empty))
+	for _, source := range unindexed {
+		gaps = append(gaps, fmt.Sprintf("%s is not indexed by any rule", source))
+	}
+	for _, ruleLabel := range empty {
+		gaps = append(gaps, fmt.Sprintf("%s has srcs but no indexed files", ruleLabel))
+	}
+	return gaps
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestIndexCoverage(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"lib/a.ts", "lib/b.ts"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lang := NewLanguage().(*JS)
+	c := config.New()
+	c.RepoRoot = repoRoot
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_index_coverage", Value: "true"}}})
+	lang.Configure(c, "lib", f)
+
+	lang.GenerateRules(language.GenerateArgs{
+		Config:       c,
+		Dir:          filepath.Join(repoRoot, "lib"),
+		Rel:          "lib",
+		RegularFiles: []string{"a.ts", "b.ts"},
+	})
+
+	// a hand-written rule only covering a.ts
+	r := rule.NewRule("ts_project", "a")
+	r.SetAttr("srcs", []string{"a.ts"})
+	lang.Imports(c, r, f)
+
+	// a glob matching no files indexes nothing
+	empty := rule.NewRule("ts_project", "empty")
+	empty.SetAttr("srcs", &bzl.CallExpr{
+		X:    &bzl.Ident{Name: "glob"},
+		List: []bzl.Expr{&bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "*.tsx"}}}},
+	})
+	lang.Imports(c, empty, f)
+
+	got := lang.coverage.report()
+	want := []string{
+		"lib/b.ts is not indexed by any rule",
+		"//lib:empty has srcs but no indexed files",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+	if got := lang.coverage.report(); got != nil {
+		t.Errorf("expected coverage to be reported once, got %#v", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// dirCache caches directory listings so that checking whether a file exists
+// only reads its directory once, instead of calling os.Stat for every
+// candidate of every import.
+type dirCache struct {
+	mu        sync.Mutex
+	dirs      map[string]*dirListing
+	canonical map[string]string
+	globs     map[*bzl.CallExpr][]string
+	reads     int
+}
+
+type dirListing struct {
+	entries []os.DirEntry
+	byName  map[string]os.DirEntry
+}
+
+func newDirCache() *dirCache {
+	return &dirCache{
+		dirs:      make(map[string]*dirListing),
+		canonical: make(map[string]string),
+		globs:     make(map[*bzl.CallExpr][]string),
+	}
+}
+
+// glob returns a copy of the files a glob() call was expanded to, if it was.
+func (d *dirCache) glob(call *bzl.CallExpr) ([]string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	files, ok := d.globs[call]
+	return append([]string(nil), files...), ok
+}
+
+// setGlob stores the files a glob() call is expanded to
+func (d *dirCache) setGlob(call *bzl.CallExpr, files []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.globs[call] = append([]string(nil), files...)
+}
+
+// readDir returns the listing of dir, reading it from disk on first use.
+// Missing directories have an empty listing.
+func (d *dirCache) readDir(dir string) *dirListing {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if listing, ok := d.dirs[dir]; ok {
+		return listing
+	}
+	d.reads++
+	listing := &dirListing{
+		byName: make(map[string]os.DirEntry),
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		listing.entries = entries
+		for _, entry := range entries {
+			listing.byName[entry.Name()] = entry
+		}
+	}
+	d.dirs[dir] = listing
+	return listing
+}
+
+// stat reports whether target exists below repoRoot and whether it is a
+// directory, following symlinks.
+func (d *dirCache) stat(repoRoot string, target string) (exists bool, isDir bool) {
+	filePath := path.Join(repoRoot, target)
+	entry, ok := d.readDir(path.Dir(filePath)).byName[path.Base(filePath)]
+	if !ok {
+		return false, false
+	}
+	if entry.Type()&os.ModeSymlink != 0 {
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			return false, false
+		}
+		return true, fileInfo.IsDir()
+	}
+	return true, entry.IsDir()
+}
+
+// matchFileCase returns the path of the file on disk matching target when
+// ignoring case, preferring exact matches for each path segment.
+func (d *dirCache) matchFileCase(repoRoot string, target string) (string, bool) {
+	matched := ""
+	for _, segment := range strings.Split(target, "/") {
+		listing := d.readDir(path.Join(repoRoot, matched))
+		found := ""
+		if _, ok := listing.byName[segment]; ok {
+			found = segment
+		} else {
+			for _, entry := range listing.entries {
+				if strings.EqualFold(entry.Name(), segment) {
+					found = entry.Name()
+					break
+				}
+			}
+		}
+		if found == "" {
+			return "", false
+		}
+		matched = path.Join(matched, found)
+	}
+	return matched, true
+}
+
+// canonicalPath returns the path of target below repoRoot with symlinks
+// resolved, like shared/a.ts for an existing linked/a.ts when linked points to
+// shared. Targets resolving outside of repoRoot have no canonical path.
+func (d *dirCache) canonicalPath(repoRoot string, target string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := path.Join(repoRoot, target)
+	if canonical, ok := d.canonical[key]; ok {
+		return canonical, canonical != ""
+	}
+	canonical := ""
+	if root, err := filepath.EvalSymlinks(repoRoot); err == nil {
+		if resolved, err := filepath.EvalSymlinks(filepath.FromSlash(key)); err == nil {
+			if rel, err := filepath.Rel(root, resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				canonical = normalizePath(filepath.ToSlash(rel))
+			}
+		}
+	}
+	d.canonical[key] = canonical
+	return canonical, canonical != ""
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirCacheStat(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "lib", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, "lib", "a.ts"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("nested", filepath.Join(repoRoot, "lib", "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := newDirCache()
+	for _, tc := range []struct {
+		target        string
+		exists, isDir bool
+	}{
+		{target: "lib/a.ts", exists: true, isDir: false},
+		{target: "lib/nested", exists: true, isDir: true},
+		{target: "lib/linked", exists: true, isDir: true},
+		{target: "lib/b.ts", exists: false, isDir: false},
+		{target: "missing/a.ts", exists: false, isDir: false},
+	} {
+		exists, isDir := dirs.stat(repoRoot, tc.target)
+		if exists != tc.exists || isDir != tc.isDir {
+			t.Errorf("stat(%q) = %v, %v; want %v, %v", tc.target, exists, isDir, tc.exists, tc.isDir)
+		}
+	}
+	if dirs.reads != 2 {
+		t.Errorf("expected 2 directory reads, got %d", dirs.reads)
+	}
+}
+
+func TestDirCacheCanonicalPath(t *testing.T) {
+	outside := t.TempDir()
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{filepath.Join(repoRoot, "shared", "a.ts"), filepath.Join(outside, "b.ts")} {
+		if err := os.WriteFile(name, []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("shared", filepath.Join(repoRoot, "linked")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(repoRoot, "external")); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := newDirCache()
+	for _, tc := range []struct {
+		target, canonical string
+		ok                bool
+	}{
+		{target: "shared/a.ts", canonical: "shared/a.ts", ok: true},
+		{target: "linked/a.ts", canonical: "shared/a.ts", ok: true},
+		{target: "linked", canonical: "shared", ok: true},
+		{target: "external/b.ts", canonical: "", ok: false},
+		{target: "linked/missing.ts", canonical: "", ok: false},
+	} {
+		canonical, ok := dirs.canonicalPath(repoRoot, tc.target)
+		if canonical != tc.canonical || ok != tc.ok {
+			t.Errorf("canonicalPath(%q) = %q, %v; want %q, %v", tc.target, canonical, ok, tc.canonical, tc.ok)
+		}
+	}
+}
+
+// BenchmarkDirCacheStat compares the syscalls needed to check the candidates
+// resolveWalkParents tries for an import, using os.Stat and the dirCache.
+func BenchmarkDirCacheStat(b *testing.B) {
+	repoRoot := b.TempDir()
+	pkg := "a/b/c/d"
+	if err := os.MkdirAll(filepath.Join(repoRoot, pkg), 0755); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, "a", "util.ts"), []byte{}, 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	// every extension in every parent directory, like an import of "util"
+	candidates := []string{}
+	for dir := pkg; dir != "."; dir = path.Dir(dir) {
+		for _, ext := range append(append([]string{""}, tsExtensions...), jsExtensions...) {
+			candidates = append(candidates, path.Join(dir, "util"+ext))
+		}
+	}
+
+	b.Run("os.Stat", func(b *testing.B) {
+		stats := 0
+		for i := 0; i < b.N; i++ {
+			for _, candidate := range candidates {
+				stats++
+				os.Stat(filepath.Join(repoRoot, candidate))
+			}
+		}
+		b.ReportMetric(float64(stats)/float64(b.N), "syscalls/op")
+	})
+
+	b.Run("dirCache", func(b *testing.B) {
+		dirs := newDirCache()
+		for i := 0; i < b.N; i++ {
+			for _, candidate := range candidates {
+				dirs.stat(repoRoot, candidate)
+			}
+		}
+		b.ReportMetric(float64(dirs.reads)/float64(b.N), "syscalls/op")
+	})
+}
@@ -17,11 +17,14 @@
 package js
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log"
 	"math"
 	"os"
 	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -32,10 +35,19 @@ import (
 
 type imports struct {
 	set map[string]bool
+	// imports of set that are only used for their types
+	types map[string]bool
+	// files referenced at runtime, eg. worker scripts
+	data map[string]bool
+	// modules located with import.meta.resolve()
+	metaResolve map[string]bool
 }
 
 var noImports = imports{
-	set: map[string]bool{},
+	set:         map[string]bool{},
+	types:       map[string]bool{},
+	data:        map[string]bool{},
+	metaResolve: map[string]bool{},
 }
 
 var jsRules = rule.LoadInfo{
@@ -140,6 +152,12 @@ func (lang *JS) GenerateRules(args language.GenerateArgs) language.GenerateResul
 		isBarrel,
 		isJSRoot = lang.collectSources(args, jsConfig)
 
+	if jsConfig.IndexCoverage {
+		for _, src := range append(append([]string{}, tsSources...), jsSources...) {
+			lang.coverage.addSource(path.Join(args.Rel, src))
+		}
+	}
+
 	if !jsConfig.Quiet && isBarrel && len(tsSources) > 0 && len(jsSources) > 0 {
 		log.Print(Warn("[WARN] ts and js files mixed in package %s", pkgName))
 	}
@@ -148,7 +166,7 @@ func (lang *JS) GenerateRules(args language.GenerateArgs) language.GenerateResul
 	generatedPkgRule := lang.genPkgRule(args, jsConfig)
 	if generatedPkgRule != nil {
 		generatedRules = append(generatedRules, generatedPkgRule)
-		generatedImports = append(generatedImports, &noImports)
+		generatedImports = append(generatedImports, lang.packageFileImports(args, jsConfig))
 	}
 
 	// add "jest_test" rule(s)
@@ -232,7 +250,7 @@ func (lang *JS) collectSources(args language.GenerateArgs, jsConfig *JsConfig) (
 		}
 
 		// if the filename is like index.(jsx) then we assume we found a module
-		if isBarrelFile(baseName) {
+		if isBarrelFile(jsConfig, baseName) {
 			isBarrel = true
 		}
 
@@ -244,7 +262,17 @@ func (lang *JS) collectSources(args language.GenerateArgs, jsConfig *JsConfig) (
 		}
 		// JS
 		match = jsExtensionsPattern.FindStringSubmatch(baseName)
-		if len(match) > 0 {
+		if len(match) > 0 || jsModuleExtensionsPattern.MatchString(baseName) {
+			jsSources = append(jsSources, baseName)
+			continue
+		}
+		// MDX
+		if isMDXFile(baseName) {
+			jsSources = append(jsSources, baseName)
+			continue
+		}
+		// HTML entrypoints
+		if jsConfig.HTMLEntrypoints && isHTMLFile(baseName) {
 			jsSources = append(jsSources, baseName)
 			continue
 		}
@@ -283,10 +311,13 @@ func (lang *JS) gatherFiles(args language.GenerateArgs, jsConfig *JsConfig) []st
 	return allFiles
 }
 
-func readFileAndParse(filePath string, rel string) (*imports, int) {
+func readFileAndParse(filePath string, rel string, jsConfig *JsConfig) (*imports, int) {
 
 	fileImports := imports{
-		set: make(map[string]bool),
+		set:         make(map[string]bool),
+		types:       make(map[string]bool),
+		data:        make(map[string]bool),
+		metaResolve: make(map[string]bool),
 	}
 
 	// If this file is a React component, always add react as dependency as the file could be using native
@@ -299,20 +330,120 @@ func readFileAndParse(filePath string, rel string) (*imports, int) {
 	if err != nil {
 		log.Fatalf(Err("Error reading %s: %v", filePath, err))
 	}
-	jsImports, testCount, err := ParseJS(data)
+	parse := ParseJS
+	if format := moduleFormat(filePath, jsConfig.PackageType); format != formatAny {
+		parse = func(data []byte) ([]string, []string, []string, []string, int, error) {
+			return ParseJSFormat(data, format)
+		}
+	} else if isMDXFile(filePath) {
+		parse = ParseMDX
+	} else if isHTMLFile(filePath) {
+		parse = ParseHTML
+	} else if isStylesheetFile(filePath) {
+		parse = ParseCSS
+	}
+	jsImports, jsTypeImports, jsDataImports, jsMetaResolveImports, testCount, err := parse(data)
 	if err != nil {
 		log.Fatalf(Err("Error parsing %s: %v", filePath, err))
 	}
 	for _, imp := range jsImports {
-		if rel != "" && strings.HasPrefix(imp, ".") {
-			imp = path.Join(rel, imp)
+		if isStylesheetFile(filePath) {
+			imp = sassImport(path.Dir(filePath), imp)
+		}
+		fileImports.set[rebaseImport(imp, rel)] = true
+	}
+	for _, imp := range jsTypeImports {
+		// JSX uses react as a value
+		if imp != "react" || !isReactFile(filePath) {
+			fileImports.types[rebaseImport(imp, rel)] = true
+		}
+	}
+	for _, imp := range jsDataImports {
+		fileImports.data[rebaseImport(imp, rel)] = true
+	}
+	for _, imp := range jsMetaResolveImports {
+		fileImports.metaResolve[rebaseImport(imp, rel)] = true
+	}
+	if jsConfig.DepCommentPattern != nil && !isHTMLFile(filePath) {
+		// dependencies declared by comments, see js_dep_comment_pattern
+		for _, imp := range ParseDepComments(data, jsConfig.DepCommentPattern) {
+			fileImports.set[rebaseImport(imp, rel)] = true
+		}
+	}
+	if jsConfig.ExpandTemplates && !isHTMLFile(filePath) && !isStylesheetFile(filePath) {
+		for _, imp := range templateImports(path.Dir(filePath), data) {
+			fileImports.data[rebaseImport(imp, rel)] = true
 		}
-		fileImports.set[imp] = true
 	}
 
 	return &fileImports, testCount
 }
 
+// templateImports returns the files in dir matched by the template literal
+// imports of data, such as ./config.dev.json and ./config.prod.json for
+// `./config.${env}.json`.
+func templateImports(dir string, data []byte) []string {
+	imps := make([]string, 0)
+	for _, glob := range ParseTemplateImports(data) {
+		matches, err := filepath.Glob(filepath.Join(dir, glob))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			imp, err := filepath.Rel(dir, match)
+			if err != nil {
+				continue
+			}
+			imp = filepath.ToSlash(imp)
+			if !strings.HasPrefix(imp, "../") {
+				imp = "./" + imp
+			}
+			imps = append(imps, imp)
+		}
+	}
+	return imps
+}
+
+// sassImport returns the file that a relative stylesheet import of dir refers
+// to, like Sass does for partials: "./base" may be "_base.scss", "base.css"
+// or "base/_index.scss". Imports that are not found are returned unchanged.
+func sassImport(dir string, imp string) string {
+	if !strings.HasPrefix(imp, ".") {
+		return imp
+	}
+	candidates := make([]string, 0)
+	for _, ext := range []string{"", ".scss", ".sass", ".css"} {
+		candidates = append(candidates,
+			imp+ext,
+			path.Join(path.Dir(imp), "_"+path.Base(imp)+ext),
+		)
+	}
+	for _, index := range []string{"_index.scss", "index.scss", "_index.sass", "index.sass"} {
+		candidates = append(candidates, path.Join(imp, index))
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(path.Join(dir, candidate)); err == nil && !info.IsDir() {
+			return relativeURL(candidate)
+		}
+	}
+	return imp
+}
+
+// rebaseImport rebases a relative import onto the package, keeping it relative
+// so that resolution starts from the directory of the source file.
+func rebaseImport(imp string, rel string) string {
+	if rel != "" && strings.HasPrefix(imp, ".") {
+		imp = path.Join(rel, imp)
+		if imp != "." && imp != ".." && !strings.HasPrefix(imp, "../") {
+			imp = "./" + imp
+		}
+	}
+	return imp
+}
+
 func (lang *JS) genPkgRule(args language.GenerateArgs, jsConfig *JsConfig) *rule.Rule {
 	for _, baseName := range args.RegularFiles {
 		if baseName == "package.json" {
@@ -327,6 +458,83 @@ func (lang *JS) genPkgRule(args language.GenerateArgs, jsConfig *JsConfig) *rule
 	return nil
 }
 
+// packageFileImports returns the files listed by the "bin" and "files" of
+// the package.json of the directory as runtime files, when
+// js_include_pkg_files is set. Directories in "files" include their
+// contents, and entries starting with "!" are excluded.
+func (lang *JS) packageFileImports(args language.GenerateArgs, jsConfig *JsConfig) *imports {
+	if !jsConfig.IncludePkgFiles {
+		return &noImports
+	}
+
+	// the package file is usually parsed already by Configure
+	packageFile := path.Join(args.Dir, "package.json")
+	pkg, err := lang.packageFiles.load(packageFile)
+	if err != nil {
+		log.Fatalf(Err("Error reading %s: %v", packageFile, err))
+	}
+
+	fileImports := imports{
+		set:         make(map[string]bool),
+		types:       make(map[string]bool),
+		data:        make(map[string]bool),
+		metaResolve: make(map[string]bool),
+	}
+
+	// "bin" is either a single script or a map of commands to scripts
+	bins := make(map[string]string)
+	var bin string
+	if json.Unmarshal(pkg.Bin, &bin) == nil {
+		bins[bin] = bin
+	} else if json.Unmarshal(pkg.Bin, &bins) != nil {
+		bins = make(map[string]string)
+	}
+	for _, script := range bins {
+		fileImports.data[relativeURL(path.Clean(script))] = true
+	}
+
+	includes := make([]string, 0, len(pkg.Files))
+	excludes := make([]string, 0)
+	for _, glob := range pkg.Files {
+		if strings.HasPrefix(glob, "!") {
+			excludes = append(excludes, path.Clean(strings.TrimPrefix(glob, "!")))
+		} else {
+			glob = path.Clean(glob)
+			includes = append(includes, glob, glob+"/**")
+		}
+	}
+	if len(includes) == 0 {
+		return &fileImports
+	}
+	includePattern, err := globPattern(includes)
+	if err != nil {
+		log.Fatalf(Err("Error parsing the files of %s: %v", packageFile, err))
+	}
+	excludePattern, err := globPattern(excludes)
+	if err != nil {
+		log.Fatalf(Err("Error parsing the files of %s: %v", packageFile, err))
+	}
+	filepath.WalkDir(args.Dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(args.Dir, filePath)
+		rel = filepath.ToSlash(rel)
+		if rel != "package.json" && includePattern.MatchString(rel) && (len(excludes) == 0 || !excludePattern.MatchString(rel)) {
+			fileImports.data["./"+rel] = true
+		}
+		return nil
+	})
+
+	return &fileImports
+}
+
 func (lang *JS) genJestTest(args language.GenerateArgs, jsConfig *JsConfig, jestSources []string) ([]*rule.Rule, []interface{}) {
 	generatedRules := make([]*rule.Rule, 0)
 	generatedImports := make([]interface{}, 0)
@@ -345,7 +553,7 @@ func (lang *JS) genJestTest(args language.GenerateArgs, jsConfig *JsConfig, jest
 			)
 			r.SetAttr("srcs", []string{baseName})
 
-			imports, jestTestCount := readFileAndParse(filePath, "")
+			imports, jestTestCount := readFileAndParse(filePath, "", jsConfig)
 
 			lang.addJestAttributes(args, jsConfig, ruleName, r, jestTestCount)
 
@@ -360,7 +568,7 @@ func (lang *JS) genJestTest(args language.GenerateArgs, jsConfig *JsConfig, jest
 		for _, baseName := range jestSources {
 			filePath := path.Join(args.Dir, baseName)
 			relativePart := path.Dir(baseName)
-			imps, tCount := readFileAndParse(filePath, relativePart)
+			imps, tCount := readFileAndParse(filePath, relativePart, jsConfig)
 			jestTestCount += tCount
 			allImports = append(allImports, *imps)
 		}
@@ -390,7 +598,7 @@ type testRuleArgs struct {
 }
 
 func (lang *JS) makeFolderTestRule(args language.GenerateArgs, jsConfig *JsConfig, testRuleArgs testRuleArgs) (*imports, *rule.Rule) {
-	imps, jestTestCount := readFileAndParse(testRuleArgs.filePath, "")
+	imps, jestTestCount := readFileAndParse(testRuleArgs.filePath, "", jsConfig)
 	ruleName := strings.TrimSuffix(testRuleArgs.baseName, testRuleArgs.extension) + ".test"
 	r := rule.NewRule(testRuleArgs.ruleType, ruleName)
 	r.SetAttr("srcs", []string{testRuleArgs.baseName})
@@ -427,7 +635,7 @@ func (lang *JS) genRules(args language.GenerateArgs, jsConfig *JsConfig, isBarre
 		if jsConfig.CollectAll {
 			relativePart = path.Dir(baseName)
 		}
-		imps, _ := readFileAndParse(filePath, relativePart)
+		imps, _ := readFileAndParse(filePath, relativePart, jsConfig)
 		imports = append(imports, *imps)
 	}
 
@@ -542,7 +750,7 @@ func (lang *JS) makeModuleRules(args moduleRuleArgs, jsConfig *JsConfig) ([]*imp
 	remainderSet := make(map[string]imports)
 
 	for i, src := range args.srcs {
-		if isBarrelFile(src) {
+		if isBarrelFile(jsConfig, src) {
 			moduleSet[src] = args.imports[i]
 			indexKey = src
 		} else {
@@ -625,6 +833,18 @@ func (lang *JS) makeModuleRules(args moduleRuleArgs, jsConfig *JsConfig) ([]*imp
 		for k, v := range imp.set {
 			copyImp.set[k] = v
 		}
+		copyImp.types = make(map[string]bool)
+		for k, v := range imp.types {
+			copyImp.types[k] = v
+		}
+		copyImp.data = make(map[string]bool)
+		for k, v := range imp.data {
+			copyImp.data[k] = v
+		}
+		copyImp.metaResolve = make(map[string]bool)
+		for k, v := range imp.metaResolve {
+			copyImp.metaResolve[k] = v
+		}
 		allImports = append(allImports, &copyImp) // Required to create references
 	}
 	allRules = append(allRules, remainderRules...)
@@ -671,11 +891,30 @@ func isLocalImport(cwd string, path string) bool {
 func flattenImports(imps []imports) *imports {
 
 	aggregatedImports := imports{
-		set: make(map[string]bool),
+		set:         make(map[string]bool),
+		types:       make(map[string]bool),
+		data:        make(map[string]bool),
+		metaResolve: make(map[string]bool),
 	}
+	valueImports := make(map[string]bool)
 	for i := range imps {
 		for k, v := range imps[i].set {
 			aggregatedImports.set[k] = v
+			if !imps[i].types[k] {
+				valueImports[k] = true
+			}
+		}
+		for k, v := range imps[i].data {
+			aggregatedImports.data[k] = v
+		}
+		for k, v := range imps[i].metaResolve {
+			aggregatedImports.metaResolve[k] = v
+		}
+	}
+	// an import stays type-only if no file imports it as a value
+	for k := range aggregatedImports.set {
+		if !valueImports[k] {
+			aggregatedImports.types[k] = true
 		}
 	}
 
@@ -708,7 +947,7 @@ func (lang *JS) genWebAssets(args language.GenerateArgs, webAssetsSet map[string
 			}
 
 			generatedRules = append(generatedRules, r)
-			generatedImports = append(generatedImports, &noImports)
+			generatedImports = append(generatedImports, stylesheetImports(args, webAssets, jsConfig))
 
 			// record all webAssets rules for all_assets rule later
 			fqName := fmt.Sprintf("//%s:%s", path.Join(args.Rel), name)
@@ -724,7 +963,7 @@ func (lang *JS) genWebAssets(args language.GenerateArgs, webAssetsSet map[string
 
 			for _, r := range rules {
 				generatedRules = append(generatedRules, r)
-				generatedImports = append(generatedImports, &noImports)
+				generatedImports = append(generatedImports, stylesheetImports(args, r.AttrStrings("srcs"), jsConfig))
 
 				// record all webAssets rules for all_assets rule later
 				fqName := fmt.Sprintf("//%s:%s", path.Join(args.Rel), r.Name())
@@ -736,6 +975,22 @@ func (lang *JS) genWebAssets(args language.GenerateArgs, webAssetsSet map[string
 	return generatedRules, generatedImports
 }
 
+// stylesheetImports returns the imports of the stylesheets among the srcs of
+// a web_assets rule, so that they depend on the stylesheets they import.
+func stylesheetImports(args language.GenerateArgs, srcs []string, jsConfig *JsConfig) *imports {
+	allImports := make([]imports, 0)
+	for _, src := range srcs {
+		if isStylesheetFile(src) {
+			imps, _ := readFileAndParse(path.Join(args.Dir, src), path.Dir(src), jsConfig)
+			allImports = append(allImports, *imps)
+		}
+	}
+	if len(allImports) == 0 {
+		return &noImports
+	}
+	return flattenImports(allImports)
+}
+
 func (lang *JS) genAllAssets(args language.GenerateArgs, isJSRoot bool, jsConfig *JsConfig) ([]*rule.Rule, []interface{}) {
 	generatedRules := make([]*rule.Rule, 0)
 	generatedImports := make([]interface{}, 0)
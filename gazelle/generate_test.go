@@ -17,7 +17,12 @@
 package js
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
 )
 
 func TestPattern(t *testing.T) {
@@ -26,3 +31,109 @@ func TestPattern(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFlattenImportsTypes(t *testing.T) {
+	imps := []imports{
+		{
+			set:   map[string]bool{"./a": true, "./types": true},
+			types: map[string]bool{"./types": true},
+		},
+		{
+			set:   map[string]bool{"./a": true, "./b": true, "./types": true},
+			types: map[string]bool{"./a": true, "./types": true},
+		},
+	}
+	want := map[string]bool{"./types": true}
+	if got := flattenImports(imps).types; !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+func TestSassImport(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"_base.scss", "theme.css", "components/_index.scss", "vendor/normalize.css"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for imp, want := range map[string]string{
+		"./base":              "./_base.scss",
+		"./theme":             "./theme.css",
+		"./theme.css":         "./theme.css",
+		"./components":        "./components/_index.scss",
+		"./vendor/normalize":  "./vendor/normalize.css",
+		"./missing":           "./missing",
+		"bootstrap/scss/grid": "bootstrap/scss/grid",
+	} {
+		if got := sassImport(dir, imp); got != want {
+			t.Errorf("sassImport(%q) = %q, want %q", imp, got, want)
+		}
+	}
+}
+
+func TestTemplateImports(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config.development.json", "config.production.json", "settings.json", "config.dir.json/nested.json"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := templateImports(dir, []byte("module.exports = require(`./config.${process.env.NODE_ENV}.json`);"))
+	want := []string{"./config.development.json", "./config.production.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+func TestPackageFileImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"package.json": `{
+  "bin": {"tool": "./bin/tool.js", "other": "bin/other.js"},
+  "files": ["lib", "types/*.d.ts", "!lib/**/*.test.js"]
+}`,
+		"bin/tool.js":                 "",
+		"bin/other.js":                "",
+		"lib/index.js":                "",
+		"lib/nested/util.js":          "",
+		"lib/nested/util.test.js":     "",
+		"types/index.d.ts":            "",
+		"src/index.ts":                "",
+		"node_modules/x/lib/index.js": "",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := language.GenerateArgs{Dir: dir}
+	lang := NewLanguage().(*JS)
+
+	jsConfig := NewJsConfig()
+	if got := lang.packageFileImports(args, jsConfig); got != &noImports {
+		t.Errorf("expected no imports unless js_include_pkg_files is set, got %#v", got)
+	}
+
+	jsConfig.IncludePkgFiles = true
+	want := map[string]bool{
+		"./bin/other.js":       true,
+		"./bin/tool.js":        true,
+		"./lib/index.js":       true,
+		"./lib/nested/util.js": true,
+		"./types/index.d.ts":   true,
+	}
+	if got := lang.packageFileImports(args, jsConfig).data; !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
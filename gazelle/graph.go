@@ -0,0 +1,106 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// depGraph exports the labels each rule resolved to, in a file of json lines
+// named by js_graph_export. The file is started over on the first rule of a
+// run, a node is appended as each rule is resolved, and the file is closed
+// once every rule is resolved.
+type depGraph struct {
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+type depGraphNode struct {
+	Label    string   `json:"label"`
+	Kind     string   `json:"kind"`
+	Deps     []string `json:"deps,omitempty"`
+	Data     []string `json:"data,omitempty"`
+	TypeDeps []string `json:"type_deps,omitempty"`
+}
+
+func newDepGraph() *depGraph {
+	return &depGraph{
+		files: make(map[string]*os.File),
+	}
+}
+
+// add appends node to the graph file at graphPath
+func (g *depGraph) add(graphPath string, node depGraphNode) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	file, opened := g.files[graphPath]
+	if !opened {
+		var err error
+		if err = os.MkdirAll(filepath.Dir(graphPath), 0755); err == nil {
+			file, err = os.OpenFile(graphPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		}
+		if err != nil {
+			log.Print(Err("failed to open graph export %s: %v", graphPath, err))
+		}
+		// failures are only reported once
+		g.files[graphPath] = file
+	}
+	if file == nil {
+		return
+	}
+
+	data, err := json.Marshal(node)
+	if err == nil {
+		_, err = file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		log.Print(Err("failed to write graph export %s: %v", graphPath, err))
+		file.Close()
+		g.files[graphPath] = nil
+	}
+}
+
+// graphLabels returns the sorted absolute labels of set
+func graphLabels(set map[string]bool, from label.Label) []string {
+	labels := formatLabels(set, "absolute", from)
+	sort.Strings(labels)
+	return labels
+}
+
+// close closes the graph files. Nodes added later are dropped.
+func (g *depGraph) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for graphPath, file := range g.files {
+		if file == nil {
+			continue
+		}
+		if err := file.Close(); err != nil {
+			log.Print(Err("failed to write graph export %s: %v", graphPath, err))
+		}
+		g.files[graphPath] = nil
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestGraphExport(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"lib/util.ts", "app/main.ts", "app/logo.png"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	graphPath := filepath.Join(repoRoot, "out", "graph.json")
+	if err := os.MkdirAll(filepath.Dir(graphPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the graph of a previous run is replaced
+	if err := os.WriteFile(graphPath, []byte(`{"label": "//stale:rule"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{
+		Pkg:        "",
+		Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_graph_export", Value: "out/graph.json"}},
+	})
+	jsConfig := c.Exts[languageName].(JsConfigs)[""]
+	jsConfig.NpmDependencies.Dependencies["react"] = "//:node_modules/"
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "lib", f)
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	util := rule.NewRule("ts_project", "util")
+	util.SetAttr("srcs", []string{"util.ts"})
+	ix.AddRule(c, util, f)
+	ix.Finish()
+
+	lang.Resolve(c, ix, nil, util, &imports{set: map[string]bool{}}, label.New("", "lib", "util"))
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := &imports{
+		set:  map[string]bool{"../lib/util": true, "react": true},
+		data: map[string]bool{"./logo.png": true},
+	}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+	data, err := os.ReadFile(graphPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes := []depGraphNode{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var node depGraphNode
+		if err := json.Unmarshal([]byte(line), &node); err != nil {
+			t.Fatalf("invalid line %q: %v", line, err)
+		}
+		nodes = append(nodes, node)
+	}
+	want := []depGraphNode{
+		{Label: "//lib:util", Kind: "ts_project"},
+		{
+			Label: "//app:main",
+			Kind:  "ts_project",
+			Deps:  []string{"//:node_modules/react", "//lib:util"},
+			Data:  []string{"//:node_modules/react", "//app:logo.png"},
+		},
+	}
+	if !reflect.DeepEqual(nodes, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", nodes, want)
+	}
+
+	// the file is closed once every rule is resolved
+	lang.(*JS).AfterResolvingDeps(context.Background())
+	if file := lang.(*JS).graph.files[graphPath]; file != nil {
+		t.Errorf("expected the graph file to be closed, got %v", file.Name())
+	}
+}
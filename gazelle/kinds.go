@@ -23,7 +23,21 @@ import (
 // Kinds returns a map of maps rule names (kinds) and information on how to
 // match and merge attributes that may be found in rules of those kinds. All
 // kinds of rules generated for this language may be found here.
-func (*JS) Kinds() map[string]rule.KindInfo {
+//
+// The same maps are returned on every call, so that the attribute named by
+// js_type_deps_attr can be marked as resolved once it is configured.
+func (lang *JS) Kinds() map[string]rule.KindInfo {
+	return lang.kinds
+}
+
+// addResolveAttr marks attr of the rules of kind as set by Resolve
+func (lang *JS) addResolveAttr(kind string, attr string) {
+	if info, ok := lang.kinds[kind]; ok {
+		info.ResolveAttrs[attr] = true
+	}
+}
+
+func jsKinds() map[string]rule.KindInfo {
 	return map[string]rule.KindInfo{
 		"js_library": {
 			MatchAny: false,
@@ -49,8 +63,9 @@ func (*JS) Kinds() map[string]rule.KindInfo {
 				"tags": true,
 			},
 			ResolveAttrs: map[string]bool{
-				"deps": true,
-				"data": true,
+				"deps":      true,
+				"data":      true,
+				"type_deps": true,
 			},
 		},
 		"ts_definition": {
@@ -101,5 +116,24 @@ func (*JS) Kinds() map[string]rule.KindInfo {
 				"tags": true,
 			},
 		},
+		// filegroups are never generated, but are indexed so that imports of
+		// the assets they provide resolve to them
+		"filegroup": {
+			MatchAny: false,
+		},
+		// copy_to_bin and copy_file rules are never generated, but their
+		// outputs are indexed like filegroup srcs, as rules_js exposes runtime
+		// assets through them
+		"copy_to_bin": {
+			MatchAny: false,
+		},
+		"copy_file": {
+			MatchAny: false,
+		},
+		// genrules are never generated, but their outs are indexed with
+		// js_index_genrule_outs so that imports of generated code resolve
+		"genrule": {
+			MatchAny: false,
+		},
 	}
 }
@@ -17,7 +17,10 @@
 package js
 
 import (
+	"context"
+
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
 )
 
 const languageName = "js"
@@ -30,8 +33,43 @@ func (*JS) Name() string {
 }
 
 type JS struct {
+	kinds        map[string]rule.KindInfo
+	dirs         *dirCache
+	packageFiles *packageFileCache
+	coverage     *indexCoverage
+	cache        *resolveCache
+	graph        *depGraph
+	// npmLookups counts the npm dependency lookups of each import
+	npmLookups map[string]int
+	// collectAllFallbacks is set once a rule is indexed under collectAllImport
+	collectAllFallbacks bool
+	// workspaceDirs maps the names of packages to the directory of their
+	// package file
+	workspaceDirs map[string]string
 }
 
 func NewLanguage() language.Language {
-	return &JS{}
+	return &JS{
+		kinds:         jsKinds(),
+		dirs:          newDirCache(),
+		packageFiles:  newPackageFileCache(),
+		coverage:      newIndexCoverage(),
+		cache:         newResolveCache(),
+		graph:         newDepGraph(),
+		npmLookups:    make(map[string]int),
+		workspaceDirs: make(map[string]string),
+	}
+}
+
+// Before is called by Gazelle before the configuration of a run.
+func (*JS) Before(ctx context.Context) {}
+
+// DoneGeneratingRules is called by Gazelle once every rule is generated,
+// before they are indexed and resolved.
+func (*JS) DoneGeneratingRules() {}
+
+// AfterResolvingDeps is called by Gazelle once every rule is resolved, and
+// closes the files written during the resolution, like the js_graph_export.
+func (lang *JS) AfterResolvingDeps(ctx context.Context) {
+	lang.graph.close()
 }
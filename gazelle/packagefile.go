@@ -0,0 +1,125 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// packageFile holds the fields of a package.json used by the configuration
+// and the package rule, with its dependencies already classified.
+type packageFile struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Main    string          `json:"main"`
+	Module  string          `json:"module"`
+	Browser json.RawMessage `json:"browser"`
+	Types   string          `json:"types"`
+	Typings string          `json:"typings"`
+	Exports json.RawMessage `json:"exports"`
+	Imports json.RawMessage `json:"imports"`
+	Bin     json.RawMessage `json:"bin"`
+	Files   []string        `json:"files"`
+
+	RawDependencies    map[string]string `json:"dependencies"`
+	RawDevDependencies map[string]string `json:"devDependencies"`
+
+	// npm packages, excluding local workspace packages like
+	// "@myorg/shared": "workspace:*"
+	dependencies    []string
+	devDependencies []string
+	workspace       []string
+	aliases         map[string]string
+}
+
+// parsePackageFile parses the contents of a package.json and classifies its
+// dependencies.
+func parsePackageFile(data []byte) (*packageFile, error) {
+	pf := &packageFile{}
+	if err := json.Unmarshal(data, pf); err != nil {
+		return nil, err
+	}
+	pf.aliases = make(map[string]string)
+	classify := func(deps map[string]string) []string {
+		npm := []string{}
+		for k, v := range deps {
+			if strings.HasPrefix(v, "workspace:") {
+				pf.workspace = append(pf.workspace, k)
+				continue
+			}
+			npm = append(npm, k)
+			if pkg, ok := npmAlias(v); ok {
+				pf.aliases[k] = pkg
+			}
+		}
+		return npm
+	}
+	pf.dependencies = classify(pf.RawDependencies)
+	pf.devDependencies = classify(pf.RawDevDependencies)
+	return pf, nil
+}
+
+// packageFileCache caches parsed package files by path, so that a package.json
+// shared by many packages is only parsed once. An entry is parsed again when
+// the modification time or size of its file changes.
+type packageFileCache struct {
+	mu     sync.Mutex
+	files  map[string]*cachedPackageFile
+	parses int
+}
+
+type cachedPackageFile struct {
+	modTime time.Time
+	size    int64
+	file    *packageFile
+}
+
+func newPackageFileCache() *packageFileCache {
+	return &packageFileCache{
+		files: make(map[string]*cachedPackageFile),
+	}
+}
+
+// load returns the parsed package file at filePath.
+func (p *packageFileCache) load(filePath string) (*packageFile, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cached, ok := p.files[filePath]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.file, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	p.parses++
+	pf, err := parsePackageFile(data)
+	if err != nil {
+		return nil, err
+	}
+	p.files[filePath] = &cachedPackageFile{modTime: info.ModTime(), size: info.Size(), file: pf}
+	return pf, nil
+}
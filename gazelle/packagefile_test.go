@@ -0,0 +1,139 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+func TestPackageFileCacheInvalidation(t *testing.T) {
+	repoRoot := t.TempDir()
+	packageFile := filepath.Join(repoRoot, "package.json")
+	if err := os.WriteFile(packageFile, []byte(`{"dependencies": {"lodash": "^4.17.21"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := newPackageFileCache()
+	for i := 0; i < 2; i++ {
+		pf, err := files.load(packageFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"lodash"}; !reflect.DeepEqual(pf.dependencies, want) {
+			t.Errorf("Inequality.\ngot  %#v;\nwant %#v", pf.dependencies, want)
+		}
+	}
+	if files.parses != 1 {
+		t.Errorf("expected 1 parse, got %d", files.parses)
+	}
+
+	// a changed file is parsed again
+	if err := os.WriteFile(packageFile, []byte(`{"devDependencies": {"jest": "^29.0.0"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(packageFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	pf, err := files.load(packageFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pf.dependencies) != 0 || !reflect.DeepEqual(pf.devDependencies, []string{"jest"}) {
+		t.Errorf("expected the changed dependencies, got %#v and %#v", pf.dependencies, pf.devDependencies)
+	}
+	if files.parses != 2 {
+		t.Errorf("expected 2 parses, got %d", files.parses)
+	}
+}
+
+// BenchmarkConfigurePackageFiles compares the parses of a Configure walk of
+// many workspace packages, followed by the generation of their package rules,
+// without and with the cache.
+func BenchmarkConfigurePackageFiles(b *testing.B) {
+	repoRoot := b.TempDir()
+	deps := "{"
+	for i := 0; i < 200; i++ {
+		if i > 0 {
+			deps += ", "
+		}
+		deps += fmt.Sprintf(`"dep-%d": "^1.0.0"`, i)
+	}
+	deps += "}"
+	if err := os.WriteFile(filepath.Join(repoRoot, "package.json"), []byte(fmt.Sprintf(`{"devDependencies": %s}`, deps)), 0644); err != nil {
+		b.Fatal(err)
+	}
+	// parents are configured before their subpackages
+	dirs := []string{"", "packages"}
+	for i := 0; i < 20; i++ {
+		workspace := fmt.Sprintf("packages/p%d", i)
+		if err := os.MkdirAll(filepath.Join(repoRoot, workspace, "src", "lib"), 0755); err != nil {
+			b.Fatal(err)
+		}
+		data := fmt.Sprintf(`{"name": "p%d", "files": ["src"], "dependencies": %s}`, i, deps)
+		if err := os.WriteFile(filepath.Join(repoRoot, workspace, "package.json"), []byte(data), 0644); err != nil {
+			b.Fatal(err)
+		}
+		dirs = append(dirs, workspace, workspace+"/src", workspace+"/src/lib")
+	}
+
+	walk := func(b *testing.B, cached bool) {
+		parses := 0
+		for i := 0; i < b.N; i++ {
+			lang := NewLanguage().(*JS)
+			c := config.New()
+			c.RepoRoot = repoRoot
+			for _, rel := range dirs {
+				f := &rule.File{Pkg: rel, Path: path.Join(rel, "BUILD")}
+				if rel == "" {
+					f.Directives = []rule.Directive{
+						{Key: "js_package_file", Value: "package.json @npm//"},
+						{Key: "js_scoped_package_files"},
+						{Key: "js_include_pkg_files"},
+					}
+				}
+				if !cached {
+					lang.packageFiles.files = make(map[string]*cachedPackageFile)
+				}
+				lang.Configure(c, rel, f)
+				dir := filepath.Join(repoRoot, rel)
+				if _, err := os.Stat(filepath.Join(dir, "package.json")); err == nil {
+					if !cached {
+						lang.packageFiles.files = make(map[string]*cachedPackageFile)
+					}
+					args := language.GenerateArgs{Config: c, Dir: dir, Rel: rel}
+					lang.packageFileImports(args, c.Exts[languageName].(JsConfigs)[rel])
+				}
+			}
+			parses += lang.packageFiles.parses
+		}
+		b.ReportMetric(float64(parses)/float64(b.N), "parses/op")
+	}
+
+	b.Run("uncached", func(b *testing.B) { walk(b, false) })
+	b.Run("packageFileCache", func(b *testing.B) { walk(b, true) })
+}
@@ -25,105 +25,476 @@ import (
 	"strings"
 )
 
-var quotePattern = regexp.MustCompile(`([/][/].*)|(?:[/][*](?:\n|.)*?[*][/])`)
+var quotePattern = regexp.MustCompile(`([/][/].*)|(?:[/][*](?:\n|.)*?[*][/])|'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*"|` + "`(?:[^`\\\\]|\\\\.)*`")
 
-func ParseJS(data []byte) ([]string, int, error) {
+// ParseJS returns the modules imported by a js/ts source file, the subset of
+// them that are only imported for their types, the files it references at
+// runtime, the modules it locates with import.meta.resolve() and the number of
+// jest tests it contains.
+func ParseJS(data []byte) ([]string, []string, []string, []string, int, error) {
+	return ParseJSFormat(data, formatAny)
+}
+
+// module formats of plain js files, see moduleFormat
+const (
+	formatAny      = ""
+	formatCommonJS = "commonjs"
+	formatModule   = "module"
+)
 
-	lastCommentMatchIndex := 0
-	codeBlocks := make([][]int, 0)
-	for _, match := range quotePattern.FindAllIndex(data, -1) {
-		codeBlocks = append(codeBlocks, []int{lastCommentMatchIndex, match[0]})
-		lastCommentMatchIndex = match[1]
+var createRequirePattern = regexp.MustCompile(`\bcreateRequire\(`)
+
+// ParseJSFormat is ParseJS for a file of the given module format. Static
+// import and export statements are ignored in commonjs files, like .cjs, and
+// require() calls in es modules, like .mjs, unless the module creates a
+// require function with createRequire().
+func ParseJSFormat(data []byte, format string) ([]string, []string, []string, []string, int, error) {
+
+	// triple-slash directives are comments, so they are read from the whole file
+	typeImports, err := parseTripleSlashReferences(data)
+	if err != nil {
+		return nil, nil, nil, nil, 0, err
 	}
-	codeBlocks = append(codeBlocks, []int{lastCommentMatchIndex, len(data)})
 
-	imports := make([]string, 0)
-	jestTestCount := 0
+	// comments are blanked out rather than split apart, so that statements
+	// wrapping around them, like `import {\n  a, // note\n} from './x'`,
+	// are still matched as a whole. String literals are matched too, so that
+	// a // inside of one, like 'https://esm.sh/lodash', is left alone.
+	code := quotePattern.ReplaceAllFunc(data, func(comment []byte) []byte {
+		if comment[0] != '/' {
+			return comment
+		}
+		if newlines := bytes.Count(comment, []byte{'\n'}); newlines > 0 {
+			return bytes.Repeat([]byte{'\n'}, newlines)
+		}
+		return []byte{' '}
+	})
+	if format == formatModule && createRequirePattern.Match(code) {
+		format = formatAny
+	}
+	imports, codeTypeImports, dataImports, resolvedImports, jestTestCount, err := parseCodeBlock(code, format)
+	if err != nil {
+		return nil, nil, nil, nil, 0, err
+	}
+	typeImports = append(typeImports, codeTypeImports...)
+
+	// a module is only type-only if it is never imported as a value
+	valueImports := make(map[string]bool, len(imports))
+	for _, imp := range imports {
+		valueImports[imp] = true
+	}
+	typeOnlyImports := make([]string, 0)
+	for _, imp := range typeImports {
+		if !valueImports[imp] {
+			typeOnlyImports = append(typeOnlyImports, imp)
+		}
+	}
+	imports = append(imports, typeImports...)
+	sort.Strings(imports)
+	sort.Strings(typeOnlyImports)
+	sort.Strings(dataImports)
+	sort.Strings(resolvedImports)
+
+	return imports, typeOnlyImports, dataImports, resolvedImports, jestTestCount, nil
+}
+
+var mdxFencePattern = regexp.MustCompile("^\\s*(```|~~~)")
+var mdxESMPattern = regexp.MustCompile(`^(import|export)\b`)
+
+// ParseMDX returns the modules imported by the ESM blocks of a mdx file, which
+// are the paragraphs starting with import or export statements. Markdown
+// content, including fenced code blocks, is ignored.
+func ParseMDX(data []byte) ([]string, []string, []string, []string, int, error) {
+
+	esm := make([][]byte, 0)
+	inFence := false
+	inESM := false
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		switch {
+		case mdxFencePattern.Match(line):
+			inFence = !inFence
+			inESM = false
+		case inFence:
+			// Code block content. Nothing to extract.
+		case len(bytes.TrimSpace(line)) == 0:
+			inESM = false
+		case inESM || mdxESMPattern.Match(line):
+			inESM = true
+			esm = append(esm, line)
+		}
+	}
+
+	return ParseJS(bytes.Join(esm, []byte{'\n'}))
+}
+
+var htmlCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+var htmlScriptPattern = regexp.MustCompile(`(?is)<script\b([^>]*)>(.*?)</script\s*>`)
+var htmlLinkPattern = regexp.MustCompile(`(?i)<link\b([^>]*)>`)
+var htmlAttrPattern = regexp.MustCompile(`([\w-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+
+// ParseHTML returns the modules referenced by the module scripts of a html
+// file, either as `<script type="module" src="...">` or through the imports
+// of an inline module script, and the stylesheets it links to as runtime
+// files. Remote URLs are ignored.
+func ParseHTML(data []byte) ([]string, []string, []string, []string, int, error) {
 
-	for _, block := range codeBlocks {
-		blockImports, blockTestCount, err := parseCodeBlock(data[block[0]:block[1]])
+	data = htmlCommentPattern.ReplaceAll(data, nil)
+
+	imports := make([]string, 0)
+	typeImports := make([]string, 0)
+	dataImports := make([]string, 0)
+	resolvedImports := make([]string, 0)
+	for _, match := range htmlScriptPattern.FindAllSubmatch(data, -1) {
+		attrs := htmlAttrs(match[1])
+		if !strings.EqualFold(attrs["type"], "module") {
+			continue
+		}
+		if src, ok := attrs["src"]; ok {
+			if isLocalURL(src) {
+				imports = append(imports, relativeURL(src))
+			}
+			continue
+		}
+		scriptImports, scriptTypeImports, scriptDataImports, scriptResolvedImports, _, err := ParseJS(match[2])
 		if err != nil {
-			return nil, 0, err
+			return nil, nil, nil, nil, 0, err
+		}
+		imports = append(imports, scriptImports...)
+		typeImports = append(typeImports, scriptTypeImports...)
+		dataImports = append(dataImports, scriptDataImports...)
+		resolvedImports = append(resolvedImports, scriptResolvedImports...)
+	}
+	for _, match := range htmlLinkPattern.FindAllSubmatch(data, -1) {
+		attrs := htmlAttrs(match[1])
+		isStylesheet := false
+		for _, rel := range strings.Fields(attrs["rel"]) {
+			isStylesheet = isStylesheet || strings.EqualFold(rel, "stylesheet")
+		}
+		if href, ok := attrs["href"]; ok && isStylesheet && isLocalURL(href) {
+			dataImports = append(dataImports, relativeURL(href))
+		}
+	}
+	sort.Strings(imports)
+	sort.Strings(typeImports)
+	sort.Strings(dataImports)
+	sort.Strings(resolvedImports)
+
+	return imports, typeImports, dataImports, resolvedImports, 0, nil
+}
+
+// htmlAttrs returns the attributes of a html tag, keyed by lowercase name
+func htmlAttrs(tag []byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range htmlAttrPattern.FindAllSubmatch(tag, -1) {
+		value := string(match[2])
+		if strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'") {
+			value = value[1 : len(value)-1]
+		}
+		attrs[strings.ToLower(string(match[1]))] = value
+	}
+	return attrs
+}
+
+// isLocalURL reports whether a html reference points at a file of the
+// repository, rather than at a remote or inline resource like "https://..."
+// or "data:..."
+func isLocalURL(url string) bool {
+	return url != "" && !strings.HasPrefix(url, "//") && !strings.Contains(url, ":")
+}
+
+// relativeURL makes a html reference like "main.ts" relative, so that it is
+// not taken for an npm package.
+func relativeURL(url string) string {
+	if strings.HasPrefix(url, ".") || strings.HasPrefix(url, "/") {
+		return url
+	}
+	return "./" + url
+}
+
+var cssImportPattern = regexp.MustCompile(`@(?:import|use|forward)\s+((?:'[^'\n]*'|"[^"\n]*"|url\([^)]*\))(?:\s*,\s*(?:'[^'\n]*'|"[^"\n]*"|url\([^)]*\)))*)`)
+var cssImportTargetPattern = regexp.MustCompile(`'([^'\n]*)'|"([^"\n]*)"|url\(\s*['"]?([^'")\s]*)['"]?\s*\)`)
+
+// ParseCSS returns the stylesheets imported by a css, scss, sass or less file
+// with @import, @use or @forward. Imports are relative to the stylesheet,
+// except for "~" prefixed imports of npm packages, like "~bootstrap/scss/grid".
+// Remote URLs and Sass built-in modules, like "sass:math", are ignored.
+func ParseCSS(data []byte) ([]string, []string, []string, []string, int, error) {
+
+	code := quotePattern.ReplaceAllFunc(data, func(comment []byte) []byte {
+		if comment[0] != '/' {
+			return comment
+		}
+		return []byte{' '}
+	})
+
+	imports := make([]string, 0)
+	for _, match := range cssImportPattern.FindAllSubmatch(code, -1) {
+		for _, target := range cssImportTargetPattern.FindAllSubmatch(match[1], -1) {
+			imp := string(bytes.Join(target[1:], nil))
+			if strings.HasPrefix(imp, "~") {
+				imports = append(imports, strings.TrimPrefix(imp, "~"))
+			} else if isLocalURL(imp) {
+				imports = append(imports, relativeURL(imp))
+			}
 		}
-		imports = append(imports, blockImports...)
-		jestTestCount += blockTestCount
 	}
 	sort.Strings(imports)
 
-	return imports, jestTestCount, nil
+	return imports, []string{}, []string{}, []string{}, 0, nil
+}
+
+var declareModulePattern = regexp.MustCompile(`(?m)^\s*declare\s+module\s+('[^'\n]+'|"[^"\n]+")`)
+
+// ParseDeclaredModules returns the module names declared by the ambient
+// `declare module '...'` declarations of a .d.ts file. Names may contain a
+// single "*" wildcard, like "*.svg".
+func ParseDeclaredModules(data []byte) ([]string, error) {
+
+	modules := make([]string, 0)
+	for _, match := range declareModulePattern.FindAllSubmatch(data, -1) {
+		unquoted, err := unquoteImportString(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("unquoting string literal %s from js, %v", match[1], err)
+		}
+		modules = append(modules, unquoted)
+	}
+	return modules, nil
 }
 
 const (
-	IMPORT         = 1
-	REQUIRE        = 2
-	EXPORT         = 3
-	JEST_MOCK      = 4
-	DYNAMIC_IMPORT = 5
+	IMPORT          = 1
+	REQUIRE         = 2
+	EXPORT          = 3
+	JEST_MOCK       = 4
+	DYNAMIC_IMPORT  = 5
+	WORKER          = 6
+	ASSET_URL       = 7
+	META_RESOLVE    = 8
+	REQUIRE_RESOLVE = 9
 )
 
 var jsImportPattern = compileJsImportPattern()
 
+// compileJsImportPattern matches static imports and exports at the start of a
+// line, while require() and import() calls are matched wherever they appear.
+// This way, calls gated by control flow (eg. `if (__DEV__) { require(...) }`)
+// are still collected, since over-declaring a dependency is safer than
+// missing one.
 func compileJsImportPattern() *regexp.Regexp {
 	stringLiteralPattern := `'(?:[^)\n]+|")*'|"(?:[^)\n]+|')*"`
-	importPattern := `^import\s(?:(?:.|\n)+?from )??(?P<import>` + stringLiteralPattern + `)`
-	requirePattern := `^\s*?(?:const .+ = )?require\((?P<require>` + stringLiteralPattern + `)\)`
-	exportPattern := `^export\s(?:(?:.|\n)+?from )??(?P<export>` + stringLiteralPattern + `)`
+	importPattern := `^import\s(?:(?:.|\n)+?from\s*)??(?P<import>` + stringLiteralPattern + `)`
+	requirePattern := `(?:^|[^.\w$])require\((?P<require>` + stringLiteralPattern + `)\)`
+	exportPattern := `^export\s(?:(?:.|\n)+?from\s*)??(?P<export>` + stringLiteralPattern + `)`
 	jestMockPattern := `^\s*?(?:const .+ = )?jest.mock\((?P<jestMock>` + stringLiteralPattern + `),`
-	dynamicImportPattern := `^.*?import\((?P<dynamicImport>` + stringLiteralPattern + `)\)`
-	return regexp.MustCompile(`(?m)` + strings.Join([]string{importPattern, requirePattern, exportPattern, jestMockPattern, dynamicImportPattern}, "|"))
+	dynamicImportPattern := `(?:^|[^.\w$])import\((?P<dynamicImport>` + stringLiteralPattern + `)\)`
+	workerPattern := `(?:^|[^.\w$])new\s+Worker\(\s*(?P<worker>` + stringLiteralPattern + `)\s*[,)]`
+	assetURLPattern := `new\s+URL\(\s*(?P<assetURL>` + stringLiteralPattern + `)\s*,\s*import\.meta\.url\s*,?\s*\)`
+	metaResolvePattern := `import\.meta\.resolve\(\s*(?P<metaResolve>` + stringLiteralPattern + `)\s*\)`
+	requireResolvePattern := `(?:^|[^.\w$])require\.resolve\(\s*(?P<requireResolve>` + stringLiteralPattern + `)\s*[,)]`
+	return regexp.MustCompile(`(?m)` + strings.Join([]string{importPattern, requirePattern, exportPattern, jestMockPattern, dynamicImportPattern, workerPattern, assetURLPattern, metaResolvePattern, requireResolvePattern}, "|"))
+}
+
+// ParseDepComments returns the modules declared by comments of js code or
+// stylesheets matching pattern, like "./polyfills" for `// @needs:./polyfills`
+// with the pattern `@needs:(\S+)`. The first group of pattern captures the
+// import.
+func ParseDepComments(data []byte, pattern *regexp.Regexp) []string {
+	imports := make([]string, 0)
+	for _, match := range quotePattern.FindAll(data, -1) {
+		if match[0] != '/' {
+			// a string literal
+			continue
+		}
+		for _, dep := range pattern.FindAllSubmatch(match, -1) {
+			if len(dep[1]) > 0 {
+				imports = append(imports, string(dep[1]))
+			}
+		}
+	}
+	sort.Strings(imports)
+
+	return imports
+}
+
+var templateImportPattern = regexp.MustCompile("(?:^|[^.\\w$])(?:require|import)\\(\\s*`([^`$]*)\\$\\{[^`}]*\\}([^`$]*)`\\s*\\)")
+
+// ParseTemplateImports returns the files imported or required by js code
+// through a template literal with a single interpolation, as a glob, like
+// "./config.*.json" for `./config.${env}.json`. Only relative templates are
+// expanded, and the interpolation never matches across a "/", so that it only
+// stands for part of its path segment.
+func ParseTemplateImports(data []byte) []string {
+
+	code := quotePattern.ReplaceAllFunc(data, func(comment []byte) []byte {
+		if comment[0] != '/' {
+			return comment
+		}
+		return []byte{' '}
+	})
+
+	globs := make([]string, 0)
+	for _, match := range templateImportPattern.FindAllSubmatch(code, -1) {
+		prefix, suffix := string(match[1]), string(match[2])
+		if !strings.HasPrefix(prefix, "./") && !strings.HasPrefix(prefix, "../") {
+			continue
+		}
+		if strings.HasSuffix(prefix, "/") && suffix == "" {
+			// a trailing segment, like `./plugins/${name}`, would match every file
+			continue
+		}
+		globs = append(globs, escapeGlob(prefix)+"*"+escapeGlob(suffix))
+	}
+	sort.Strings(globs)
+
+	return globs
+}
+
+// escapeGlob quotes the characters of s that have a meaning in a glob
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+var tripleSlashReferencePattern = regexp.MustCompile(`(?m)^\s*///\s*<reference\s+(path|types)\s*=\s*('[^'\n]+'|"[^"\n]+")\s*/>`)
+
+// parseTripleSlashReferences returns the modules referenced by triple-slash
+// directives. `path` references are files relative to the source, while
+// `types` references are the @types package of a module.
+func parseTripleSlashReferences(data []byte) ([]string, error) {
+
+	imports := make([]string, 0)
+	for _, match := range tripleSlashReferencePattern.FindAllSubmatch(data, -1) {
+		unquoted, err := unquoteImportString(match[2])
+		if err != nil {
+			return nil, fmt.Errorf("unquoting string literal %s from js, %v", match[2], err)
+		}
+		if string(match[1]) == "types" {
+			imports = append(imports, "@types/"+strings.Replace(strings.TrimPrefix(unquoted, "@"), "/", "__", 1))
+		} else if strings.HasPrefix(unquoted, ".") || strings.HasPrefix(unquoted, "/") {
+			imports = append(imports, unquoted)
+		} else {
+			imports = append(imports, "./"+unquoted)
+		}
+	}
+	return imports, nil
 }
 
 var jestTestPattern = regexp.MustCompile(`(?m)^\s*it\(`)
 
-func parseCodeBlock(data []byte) ([]string, int, error) {
+// typeOnlyPattern matches `import type` and `export type` statements, which
+// TypeScript erases from the emitted js. `import type from '...'` is a default
+// import named "type".
+var typeOnlyPattern = regexp.MustCompile(`^(?:import|export)\s+type\s+(?:[{*]|[\w$]+\s+from\s)`)
+
+func parseCodeBlock(data []byte, format string) ([]string, []string, []string, []string, int, error) {
 
 	imports := make([]string, 0)
+	typeImports := make([]string, 0)
+	dataImports := make([]string, 0)
+	resolvedImports := make([]string, 0)
 	for _, match := range jsImportPattern.FindAllSubmatch(data, -1) {
 		switch {
+		case format == formatCommonJS && (match[IMPORT] != nil || match[EXPORT] != nil):
+			// not a statement of commonjs, eg. code in a template literal
+
+		case format == formatModule && (match[REQUIRE] != nil || match[REQUIRE_RESOLVE] != nil):
+			// require is not defined in es modules
+
 		case match[IMPORT] != nil:
 			unquoted, err := unquoteImportString(match[IMPORT])
 			if err != nil {
-				return nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[IMPORT], err)
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[IMPORT], err)
+			}
+			if typeOnlyPattern.Match(match[0]) {
+				typeImports = append(typeImports, unquoted)
+			} else {
+				imports = append(imports, unquoted)
 			}
-			imports = append(imports, unquoted)
 
 		case match[REQUIRE] != nil:
 			unquoted, err := unquoteImportString(match[REQUIRE])
 			if err != nil {
-				return nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[REQUIRE], err)
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[REQUIRE], err)
 			}
 			imports = append(imports, unquoted)
 
 		case match[EXPORT] != nil:
 			unquoted, err := unquoteImportString(match[EXPORT])
 			if err != nil {
-				return nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[EXPORT], err)
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[EXPORT], err)
+			}
+			if typeOnlyPattern.Match(match[0]) {
+				typeImports = append(typeImports, unquoted)
+			} else {
+				imports = append(imports, unquoted)
 			}
-			imports = append(imports, unquoted)
 
 		case match[JEST_MOCK] != nil:
 			unquoted, err := unquoteImportString(match[JEST_MOCK])
 			if err != nil {
-				return nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[JEST_MOCK], err)
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[JEST_MOCK], err)
 			}
 			imports = append(imports, unquoted)
 
 		case match[DYNAMIC_IMPORT] != nil:
 			unquoted, err := unquoteImportString(match[DYNAMIC_IMPORT])
 			if err != nil {
-				return nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[DYNAMIC_IMPORT], err)
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[DYNAMIC_IMPORT], err)
 			}
 			imports = append(imports, unquoted)
 
+		case match[WORKER] != nil:
+			// worker scripts are loaded at runtime
+			unquoted, err := unquoteImportString(match[WORKER])
+			if err != nil {
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[WORKER], err)
+			}
+			dataImports = append(dataImports, unquoted)
+
+		case match[ASSET_URL] != nil:
+			// files referenced by new URL(..., import.meta.url), like workers,
+			// wasm modules or images, are loaded at runtime
+			unquoted, err := unquoteImportString(match[ASSET_URL])
+			if err != nil {
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[ASSET_URL], err)
+			}
+			dataImports = append(dataImports, unquoted)
+
+		case match[META_RESOLVE] != nil:
+			// modules located for plugin loading, routed by js_import_meta_resolve
+			unquoted, err := unquoteImportString(match[META_RESOLVE])
+			if err != nil {
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[META_RESOLVE], err)
+			}
+			resolvedImports = append(resolvedImports, unquoted)
+
+		case match[REQUIRE_RESOLVE] != nil:
+			// require.resolve() locates a file without loading it, which is
+			// then read or spawned at runtime
+			unquoted, err := unquoteImportString(match[REQUIRE_RESOLVE])
+			if err != nil {
+				return nil, nil, nil, nil, 0, fmt.Errorf("unquoting string literal %s from js, %v", match[REQUIRE_RESOLVE], err)
+			}
+			dataImports = append(dataImports, unquoted)
+
 		default:
 			// Comment matched. Nothing to extract.
 		}
 	}
 	sort.Strings(imports)
+	sort.Strings(typeImports)
+	sort.Strings(dataImports)
+	sort.Strings(resolvedImports)
 
 	jestTestCount := len(jestTestPattern.FindAll(data, -1))
 
-	return imports, jestTestCount, nil
+	return imports, typeImports, dataImports, resolvedImports, jestTestCount, nil
 }
 
 // unquoteImportString takes a string that has a complex quoting around it
@@ -18,6 +18,7 @@ package js
 
 import (
 	"reflect"
+	"regexp"
 	"testing"
 )
 
@@ -32,6 +33,13 @@ func TestParseJS(t *testing.T) {
 			js:   "",
 			want: []string{},
 		},
+		{
+			desc: "import url",
+			name: "url.js",
+			js: `import lodash from 'https://esm.sh/lodash'; // remote
+import config from "data:application/json,{}";`,
+			want: []string{"data:application/json,{}", "https://esm.sh/lodash"},
+		},
 		{
 			desc: "import single quote",
 			name: "single.js",
@@ -138,10 +146,111 @@ if (process.ENV.SHOULD_IMPORT) {
 			const foo = import('dynamic_module2.js')`,
 			want: []string{"dynamic_module.js", "dynamic_module2.js"},
 		},
+		{
+			desc: "conditional require",
+			name: "conditional_require.js",
+			js: `if (__DEV__) { require('./devtools') }
+if (process.env.NODE_ENV !== "production") {
+	module.exports = require("./dev");
+}`,
+			want: []string{"./dev", "./devtools"},
+		},
+		{
+			desc: "import.meta.env gated dynamic imports",
+			name: "env_imports.ts",
+			js: `if (import.meta.env.PROD) {
+	await import("./analytics");
+} else if (import.meta.env.DEV) {
+	import("./devtools").then((m) => m.install());
+}
+const render = import.meta.env.SSR ? import("./server") : import("./client");`,
+			want: []string{"./analytics", "./client", "./devtools", "./server"},
+		},
+		{
+			desc: "try require",
+			name: "try_require.js",
+			js: `try { require("optional-dep") } catch (e) {}
+try {
+	var other = require("other-optional-dep");
+} catch (e) {}`,
+			want: []string{"optional-dep", "other-optional-dep"},
+		},
+		{
+			desc: "function imports",
+			name: "function_imports.js",
+			js: `function load() {
+	return import("./lazy");
+}
+const loadOther = async () => { await import("./other_lazy"); };`,
+			want: []string{"./lazy", "./other_lazy"},
+		},
+		{
+			desc: "several requires per line",
+			name: "several_requires.js",
+			js:   `const a = require("a"), b = require("b");`,
+			want: []string{"a", "b"},
+		},
+		{
+			desc: "ignores member require",
+			name: "member_require.js",
+			js:   `const a = loader.require("a");`,
+			want: []string{},
+		},
+		{
+			desc: "triple-slash path reference",
+			name: "globals.d.ts",
+			js: `/// <reference path="./types.d.ts" />
+/// <reference path='legacy/globals.d.ts'/>
+declare const VERSION: string;`,
+			want: []string{"./legacy/globals.d.ts", "./types.d.ts"},
+		},
+		{
+			desc: "triple-slash types reference",
+			name: "env.d.ts",
+			js: `/// <reference types="node" />
+/// <reference types="@testing-library/jest-dom" />
+/// <reference lib="dom" />`,
+			want: []string{"@types/node", "@types/testing-library__jest-dom"},
+		},
+		{
+			desc: "import multiline with comments",
+			name: "wrapped_comments.ts",
+			js: `import {
+	a, // the first one
+	/* b is deprecated */ b,
+	/**
+	 * c
+	 */
+	c,
+} from './x';
+export {
+	// re-exported
+	d,
+} from "./y";`,
+			want: []string{"./x", "./y"},
+		},
+		{
+			desc: "import specifier on its own line",
+			name: "wrapped_from.ts",
+			js: `import {
+	aVeryLongName,
+} from
+	'./some/deeply/nested/module';`,
+			want: []string{"./some/deeply/nested/module"},
+		},
+		{
+			desc: "import after multiline comment",
+			name: "license.js",
+			js: `/*
+ * Copyright
+ */
+import a from './a';`,
+			want: []string{"./a"},
+		},
 	} {
 		t.Run(tc.desc, func(t *testing.T) {
 
-			imports, _, err := ParseJS([]byte(tc.js))
+			imports, _, _, _, _, err := ParseJS([]byte(tc.js))
 			if err != nil {
 				t.Error(err)
 				t.FailNow()
@@ -153,3 +262,590 @@ if (process.ENV.SHOULD_IMPORT) {
 		})
 	}
 }
+
+func TestParseJSRuntimeFiles(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, js string
+		want, wantData []string
+	}{
+		{
+			desc:     "node worker",
+			name:     "node_worker.js",
+			js:       `const worker = new Worker('./worker.js');`,
+			want:     []string{},
+			wantData: []string{"./worker.js"},
+		},
+		{
+			desc:     "node worker with options",
+			name:     "node_worker_options.js",
+			js:       `const worker = new Worker("./worker.js", { workerData: 42 });`,
+			want:     []string{},
+			wantData: []string{"./worker.js"},
+		},
+		{
+			desc:     "worker after require",
+			name:     "worker_after_require.js",
+			js:       `const a = require("./a"), w = new Worker("./w.js");`,
+			want:     []string{"./a"},
+			wantData: []string{"./w.js"},
+		},
+		{
+			desc: "browser worker",
+			name: "browser_worker.js",
+			js: `import { a } from "./a";
+const worker = new Worker(new URL('./worker.js', import.meta.url), { type: "module" });`,
+			want:     []string{"./a"},
+			wantData: []string{"./worker.js"},
+		},
+		{
+			desc: "asset urls",
+			name: "asset_urls.js",
+			js: `const logo = new URL('./logo.png', import.meta.url);
+const fonts = [new URL("./a.woff2", import.meta.url), new URL("./b.woff2", import.meta.url)];
+const wasm = await WebAssembly.instantiateStreaming(fetch(new URL(
+	'./module.wasm',
+	import.meta.url,
+)));`,
+			want:     []string{},
+			wantData: []string{"./a.woff2", "./b.woff2", "./logo.png", "./module.wasm"},
+		},
+		{
+			desc:     "non literal url",
+			name:     "non_literal_url.js",
+			js:       `const page = new URL(path, import.meta.url); const api = new URL('./api', base);`,
+			want:     []string{},
+			wantData: []string{},
+		},
+		{
+			desc:     "non literal worker",
+			name:     "non_literal_worker.js",
+			js:       `const worker = new Worker(path.join(__dirname, 'worker.js'));`,
+			want:     []string{},
+			wantData: []string{},
+		},
+		{
+			desc: "require resolve",
+			name: "config_loader.js",
+			js: `const config = require.resolve('./config');
+const plugin = require.resolve("some-pkg/plugin", { paths: [__dirname] });
+const other = require('./other');`,
+			want:     []string{"./other"},
+			wantData: []string{"./config", "some-pkg/plugin"},
+		},
+		{
+			desc:     "non literal require resolve",
+			name:     "non_literal_require_resolve.js",
+			js:       `const plugin = require.resolve(name); const x = loader.require.resolve('./x');`,
+			want:     []string{},
+			wantData: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, _, dataImports, _, _, err := ParseJS([]byte(tc.js))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+			if !reflect.DeepEqual(dataImports, tc.wantData) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", dataImports, tc.wantData)
+			}
+		})
+	}
+}
+
+func TestParseJSFormat(t *testing.T) {
+	for _, tc := range []struct {
+		desc, format, js string
+		want, wantData   []string
+	}{
+		{
+			desc:   "commonjs",
+			format: formatCommonJS,
+			js: `const yargs = require("yargs");
+const config = require.resolve("./config.cjs");
+const banner = ` + "`" + `
+import React from "react";
+` + "`" + `;`,
+			want:     []string{"yargs"},
+			wantData: []string{"./config.cjs"},
+		},
+		{
+			desc:   "module",
+			format: formatModule,
+			js: `import lodash from "lodash";
+export { x } from "./x.js";
+const pad = typeof require === "function" ? require("left-pad") : null;
+const later = await import("./later.js");`,
+			want:     []string{"./later.js", "./x.js", "lodash"},
+			wantData: []string{},
+		},
+		{
+			desc:   "module with createRequire",
+			format: formatModule,
+			js: `import { createRequire } from "module";
+const require = createRequire(import.meta.url);
+const pkg = require("./package.json");`,
+			want:     []string{"./package.json", "module"},
+			wantData: []string{},
+		},
+		{
+			desc:   "any",
+			format: formatAny,
+			js: `import a from "a";
+const b = require("b");`,
+			want:     []string{"a", "b"},
+			wantData: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			imports, _, dataImports, _, _, err := ParseJSFormat([]byte(tc.js), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+			if !reflect.DeepEqual(dataImports, tc.wantData) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", dataImports, tc.wantData)
+			}
+		})
+	}
+
+	for _, tc := range []struct{ baseName, packageType, want string }{
+		{"cli.cjs", formatModule, formatCommonJS},
+		{"main.mjs", "", formatModule},
+		{"helper.js", formatModule, formatModule},
+		{"helper.js", formatCommonJS, formatCommonJS},
+		{"helper.js", "", formatAny},
+		{"helper.ts", formatModule, formatAny},
+	} {
+		if got := moduleFormat(tc.baseName, tc.packageType); got != tc.want {
+			t.Errorf("moduleFormat(%q, %q) = %q, want %q", tc.baseName, tc.packageType, got, tc.want)
+		}
+	}
+}
+
+func TestParseJSTypeImports(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, js  string
+		want, wantTypes []string
+	}{
+		{
+			desc:      "import type",
+			name:      "import_type.ts",
+			js:        `import type { A } from './types';`,
+			want:      []string{"./types"},
+			wantTypes: []string{"./types"},
+		},
+		{
+			desc: "type-only barrel",
+			name: "types.ts",
+			js: `export type { A } from './a';
+export type { B } from './b';
+export type * as C from './c';`,
+			want:      []string{"./a", "./b", "./c"},
+			wantTypes: []string{"./a", "./b", "./c"},
+		},
+		{
+			desc: "type and value import",
+			name: "type_and_value.ts",
+			js: `import type { A } from './a';
+import { b } from './a';`,
+			want:      []string{"./a", "./a"},
+			wantTypes: []string{},
+		},
+		{
+			desc:      "inline type specifier",
+			name:      "inline_type.ts",
+			js:        `import { type A } from './a';`,
+			want:      []string{"./a"},
+			wantTypes: []string{},
+		},
+		{
+			desc:      "default import named type",
+			name:      "default_type.js",
+			js:        `import type from './type';`,
+			want:      []string{"./type"},
+			wantTypes: []string{},
+		},
+		{
+			desc:      "type alias export",
+			name:      "type_alias.ts",
+			js:        `export type A = { a: string };`,
+			want:      []string{},
+			wantTypes: []string{},
+		},
+		{
+			desc:      "types reference",
+			name:      "env.d.ts",
+			js:        `/// <reference types="node" />`,
+			want:      []string{"@types/node"},
+			wantTypes: []string{"@types/node"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, typeImports, _, _, _, err := ParseJS([]byte(tc.js))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+			if !reflect.DeepEqual(typeImports, tc.wantTypes) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", typeImports, tc.wantTypes)
+			}
+		})
+	}
+}
+
+func TestParseJSMetaResolve(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, js     string
+		want, wantResolved []string
+	}{
+		{
+			desc:         "relative module",
+			name:         "relative.js",
+			js:           `const plugin = await import(import.meta.resolve('./plugin'));`,
+			want:         []string{},
+			wantResolved: []string{"./plugin"},
+		},
+		{
+			desc: "package module",
+			name: "package.js",
+			js: `const url = import.meta.resolve(
+  "some-plugin"
+);`,
+			want:         []string{},
+			wantResolved: []string{"some-plugin"},
+		},
+		{
+			desc:         "non literal",
+			name:         "non_literal.js",
+			js:           `const url = import.meta.resolve(name);`,
+			want:         []string{},
+			wantResolved: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, _, _, resolvedImports, _, err := ParseJS([]byte(tc.js))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+			if !reflect.DeepEqual(resolvedImports, tc.wantResolved) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", resolvedImports, tc.wantResolved)
+			}
+		})
+	}
+}
+
+func TestParseMDX(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, mdx string
+		want            []string
+	}{
+		{
+			desc: "empty",
+			name: "empty.mdx",
+			mdx:  "",
+			want: []string{},
+		},
+		{
+			desc: "esm block",
+			name: "esm.mdx",
+			mdx: `import Chart from './Chart'
+import logo from "./logo.png"
+export { meta } from "./meta"
+
+# Hello
+
+<Chart />
+`,
+			want: []string{"./Chart", "./logo.png", "./meta"},
+		},
+		{
+			desc: "multiline import",
+			name: "multiline.mdx",
+			mdx: `import {
+	Chart,
+	Table,
+} from './components'
+
+# Hello
+`,
+			want: []string{"./components"},
+		},
+		{
+			desc: "ignores markdown content",
+			name: "markdown.mdx",
+			mdx: "import Chart from './Chart'\n" +
+				"\n" +
+				"To use it, import Chart from the package, or require(\"chart\").\n" +
+				"\n" +
+				"```js\n" +
+				"import Other from './Other'\n" +
+				"const x = require('x')\n" +
+				"```\n",
+			want: []string{"./Chart"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, _, _, _, _, err := ParseMDX([]byte(tc.mdx))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDeclaredModules(t *testing.T) {
+	for _, tc := range []struct {
+		desc, dts string
+		want      []string
+	}{
+		{
+			desc: "empty",
+			dts:  "",
+			want: []string{},
+		},
+		{
+			desc: "shorthand and block declarations",
+			dts: `declare module 'untyped-pkg';
+declare module "*.svg" {
+  const content: string;
+  export default content;
+}
+`,
+			want: []string{"untyped-pkg", "*.svg"},
+		},
+		{
+			desc: "nested in global declaration",
+			dts: `export {};
+declare global {
+  interface Window { app: unknown }
+}
+  declare module '*?inline' {
+    const css: string;
+    export default css;
+  }
+`,
+			want: []string{"*?inline"},
+		},
+		{
+			desc: "commented declaration",
+			dts:  `// see declare module 'other'`,
+			want: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			modules, err := ParseDeclaredModules([]byte(tc.dts))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(modules, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", modules, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, html string
+		want, wantData   []string
+	}{
+		{
+			desc: "vite entrypoint",
+			name: "index.html",
+			html: `<!DOCTYPE html>
+<html>
+  <head>
+    <link rel="stylesheet" href="./style.css" />
+    <link rel="icon" href="./favicon.ico" />
+  </head>
+  <body>
+    <script type="module" src="/src/main.ts"></script>
+  </body>
+</html>`,
+			want:     []string{"/src/main.ts"},
+			wantData: []string{"./style.css"},
+		},
+		{
+			desc: "inline module script",
+			name: "inline.html",
+			html: `<script type="module">
+import { start } from "./app";
+import "./polyfills";
+
+start();
+</script>`,
+			want:     []string{"./app", "./polyfills"},
+			wantData: []string{},
+		},
+		{
+			desc:     "unquoted and bare references",
+			name:     "bare.html",
+			html:     `<LINK REL="preload stylesheet" HREF=theme.css><script src='main.js' type=module></script>`,
+			want:     []string{"./main.js"},
+			wantData: []string{"./theme.css"},
+		},
+		{
+			desc: "ignored references",
+			name: "ignored.html",
+			html: `<!-- <script type="module" src="./old.ts"></script> -->
+<script src="./classic.js"></script>
+<script type="module" src="https://cdn.example.com/lib.js"></script>
+<link rel="stylesheet" href="//cdn.example.com/lib.css">
+<script type="text/javascript">import("./ignored");</script>`,
+			want:     []string{},
+			wantData: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, _, dataImports, _, _, err := ParseHTML([]byte(tc.html))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+			if !reflect.DeepEqual(dataImports, tc.wantData) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", dataImports, tc.wantData)
+			}
+		})
+	}
+}
+
+func TestParseCSS(t *testing.T) {
+	for _, tc := range []struct {
+		desc, name, css string
+		want            []string
+	}{
+		{
+			desc: "css import",
+			name: "style.css",
+			css: `@import './base.css';
+@import url("theme.css") screen;
+@import url(print.css);
+body { margin: 0; }`,
+			want: []string{"./base.css", "./print.css", "./theme.css"},
+		},
+		{
+			desc: "sass modules",
+			name: "main.scss",
+			css: `@use 'sass:math';
+@use "base" as b;
+@forward "src/list" hide list-reset;
+@import 'variables', 'mixins';`,
+			want: []string{"./base", "./mixins", "./src/list", "./variables"},
+		},
+		{
+			desc: "npm import",
+			name: "vendor.scss",
+			css:  `@import '~bootstrap/scss/grid';`,
+			want: []string{"bootstrap/scss/grid"},
+		},
+		{
+			desc: "ignored imports",
+			name: "ignored.scss",
+			css: `// @import 'commented';
+/* @use "also-commented"; */
+@import url("https://fonts.googleapis.com/css?family=Roboto");
+@import "//cdn.example.com/lib.css";
+@use "sass:map";`,
+			want: []string{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+
+			imports, _, _, _, _, err := ParseCSS([]byte(tc.css))
+			if err != nil {
+				t.Error(err)
+				t.FailNow()
+			}
+
+			if !reflect.DeepEqual(imports, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imports, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTemplateImports(t *testing.T) {
+	for _, tc := range []struct {
+		desc, code string
+		want       []string
+	}{
+		{
+			desc: "env config",
+			code: "const config = require(`./config.${process.env.NODE_ENV}.json`);",
+			want: []string{"./config.*.json"},
+		},
+		{
+			desc: "dynamic import",
+			code: "const messages = await import(`../locales/${lang}/messages.json`);",
+			want: []string{"../locales/*/messages.json"},
+		},
+		{
+			desc: "skipped templates",
+			code: "require(`${root}/config.json`);\n" +
+				"require(`./plugins/${name}`);\n" +
+				"require(`./${a}.${b}.json`);\n" +
+				"// require(`./commented.${env}.json`);\n" +
+				"require(`lodash/${fn}`);",
+			want: []string{},
+		},
+		{
+			desc: "escaped glob characters",
+			code: "require(`./[id]/page.${ext}`);",
+			want: []string{`./\[id]/page.*`},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := ParseTemplateImports([]byte(tc.code)); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDepComments(t *testing.T) {
+	pattern := regexp.MustCompile(`@needs:(\S+)`)
+	code := `// @needs:./polyfills
+import { a } from "./a";
+/* loaded by the runtime
+ * @needs:reflect-metadata @needs:./setup.css
+ */
+const note = "// @needs:./not-a-comment";
+`
+	want := []string{"./polyfills", "./setup.css", "reflect-metadata"}
+	if got := ParseDepComments([]byte(code), pattern); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
@@ -17,11 +17,13 @@
 package js
 
 import (
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
@@ -29,6 +31,7 @@ import (
 	"github.com/bazelbuild/bazel-gazelle/repo"
 	"github.com/bazelbuild/bazel-gazelle/resolve"
 	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
 )
 
 // BUILTINS list taken from https://github.com/sindresorhus/builtin-modules/blob/master/builtin-modules.json
@@ -89,13 +92,71 @@ func (lang *JS) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.
 	jsConfigs := c.Exts[languageName].(JsConfigs)
 	jsConfig := jsConfigs[f.Pkg]
 
-	srcs := r.AttrStrings("srcs")
+	if _, ok := vendorDir(jsConfig, f.Pkg); ok {
+		// vendored sources are provided by the vendor target
+		return nil
+	}
+
+	if r.Kind() == "genrule" {
+		if !jsConfig.GenruleOuts {
+			return nil
+		}
+		// generated files are imported by their output path
+		importSpecs := make([]resolve.ImportSpec, 0)
+		for _, out := range r.AttrStrings("outs") {
+			filePath := normalizePath(f.Pkg, out)
+			if !jsConfig.ExclusionPattern.MatchString(filePath) {
+				importSpecs = append(importSpecs, resolve.ImportSpec{
+					Lang: lang.Name(),
+					Imp:  filePath,
+				})
+			}
+		}
+		return importSpecs
+	}
+
+	// labels in srcs are embedded rules, not source files
+	srcs := make([]string, 0)
+	for _, src := range lang.evalSrcs(r.Attr("srcs"), c, f.Pkg) {
+		if !isLabel(src) {
+			srcs = append(srcs, src)
+		}
+	}
+
+	// srcs that can't be evaluated, like a loaded MY_SRCS list, are listed from disk
+	if jsConfig.FilesystemIndex && len(srcs) == 0 && unevaluatedSrcs(r.Attr("srcs")) {
+		srcs = lang.filesystemSrcs(c, r, f)
+	}
 
 	importSpecs := make([]resolve.ImportSpec, 0)
 
+	if r.Kind() == "copy_file" {
+		// the copy is imported by its output path
+		srcs = nil
+		if out := r.AttrString("out"); out != "" && !isLabel(out) {
+			srcs = append(srcs, out)
+		}
+	}
+
+	if r.Kind() == "filegroup" || r.Kind() == "copy_to_bin" || r.Kind() == "copy_file" {
+		// filegroup and copied srcs are indexed as assets, ranked above other
+		// providers
+		for _, src := range srcs {
+			importSpecs = append(importSpecs, resolve.ImportSpec{
+				Lang: lang.Name(),
+				Imp:  assetImport(normalizePath(f.Pkg, src)),
+			})
+		}
+		return importSpecs
+	}
+
 	// index each source file
 	for _, src := range srcs {
-		filePath := path.Join(f.Pkg, src)
+		filePath := normalizePath(f.Pkg, src)
+		if jsConfig.ExclusionPattern.MatchString(filePath) {
+			// provided by a dedicated rule
+			continue
+		}
 		importSpecs = append(importSpecs, resolve.ImportSpec{
 			Lang: lang.Name(),
 			Imp:  filePath,
@@ -105,7 +166,7 @@ func (lang *JS) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.
 	isBarrel := false
 	// look for index.js and mark this rule as a module rule
 	for _, src := range srcs {
-		if isBarrelFile(src) {
+		if isBarrelFile(jsConfig, src) {
 			isBarrel = true
 			break
 		}
@@ -120,8 +181,7 @@ func (lang *JS) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.
 	}
 
 	// Any subfolders could be used to depend on this rule
-	folderImports := jsConfig.CollectAll && (r.Kind() == getKind(c, "ts_project") || r.Kind() == getKind(c, "js_library"))
-	if folderImports {
+	if jsConfig.CollectAll && collectAllKind(c, jsConfig, r.Kind()) {
 		base := filepath.Dir(f.Path)
 		subDirectories := make(map[string]bool)
 		for _, src := range srcs {
@@ -129,9 +189,18 @@ func (lang *JS) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.
 			subDirectories[dir] = true
 		}
 		for subDirectory, _ := range subDirectories {
+			if lang.otherBarrel(c, jsConfig, f.Pkg, subDirectory, srcs) {
+				// the directory resolves to the rule of its barrel file
+				continue
+			}
 			root := strings.TrimSuffix(base, f.Pkg)
 			relPath := strings.TrimPrefix(subDirectory, root)
 			path := fmt.Sprintf("%s/%s", f.Pkg, relPath)
+			if jsConfig.CollectAllFallback {
+				// rules providing the subfolder itself are preferred
+				path = collectAllImport(path)
+				lang.collectAllFallbacks = true
+			}
 			importSpecs = append(importSpecs, resolve.ImportSpec{
 				Lang: lang.Name(),
 				Imp:  path,
@@ -139,17 +208,256 @@ func (lang *JS) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.
 		}
 	}
 
+	if jsConfig.IndexCoverage && r.Attr("srcs") != nil {
+		imps := make([]string, 0, len(importSpecs))
+		for _, spec := range importSpecs {
+			imps = append(imps, spec.Imp)
+		}
+		lang.coverage.addRule(label.New("", f.Pkg, r.Name()).String(), imps)
+	}
+
+	// files in several rules are also indexed by the contexts of the rule, so
+	// that importers of one context can pick it
+	if jsConfig.ContextAttr != "" {
+		contexts := r.AttrStrings(jsConfig.ContextAttr)
+		if context := r.AttrString(jsConfig.ContextAttr); context != "" {
+			contexts = append(contexts, context)
+		}
+		specs := importSpecs
+		for _, context := range contexts {
+			for _, spec := range specs {
+				importSpecs = append(importSpecs, resolve.ImportSpec{
+					Lang: lang.Name(),
+					Imp:  contextImport(context, spec.Imp),
+				})
+			}
+		}
+	}
+
+	if jsConfig.ResolveCache != "" {
+		// cached resolutions are only valid for the same index
+		for _, spec := range importSpecs {
+			lang.cache.addInput(fmt.Sprintf("index %s %s %s", label.New("", f.Pkg, r.Name()), r.Kind(), spec.Imp))
+		}
+	}
+
 	return importSpecs
 }
 
+// otherBarrel reports whether dir, relative to pkg, contains a barrel file
+// that is not one of srcs. Barrel specs take precedence over the subfolder
+// specs of collect-all rules, so that a directory has a single provider.
+func (lang *JS) otherBarrel(c *config.Config, jsConfig *JsConfig, pkg string, dir string, srcs []string) bool {
+	for _, entry := range lang.dirs.readDir(path.Join(c.RepoRoot, pkg, dir)).entries {
+		if entry.IsDir() || !isBarrelFile(jsConfig, entry.Name()) {
+			continue
+		}
+		barrel := path.Join(dir, entry.Name())
+		owned := false
+		for _, src := range srcs {
+			if path.Clean(src) == barrel {
+				owned = true
+				break
+			}
+		}
+		if !owned {
+			return true
+		}
+	}
+	return false
+}
+
+// collectAllKind reports whether rules of the given kind index their
+// subfolders as importable paths when CollectAll is enabled.
+func collectAllKind(c *config.Config, jsConfig *JsConfig, kind string) bool {
+	for k := range jsConfig.CollectAllKinds {
+		if kind == k || kind == getKind(c, k) {
+			return true
+		}
+	}
+	return false
+}
+
 // Embeds returns a list of labels of rules that the given rule embeds. If
 // a rule is embedded by another importable rule of the same language, only
 // the embedding rule will be indexed. The embedding rule will inherit
 // the imports of the embedded rule.
+//
+// By convention, rules embed the rules listed as labels in their srcs, eg. a
+// js_library wrapping a ts_project, so that only the wrapper is indexed.
 func (*JS) Embeds(r *rule.Rule, from label.Label) []label.Label {
+	switch r.Kind() {
+	case "web_assets", "web_asset", "filegroup", "genrule", "copy_to_bin", "copy_file":
+		// web_assets aggregate other rules rather than wrapping them, and
+		// genrules and copies consume their srcs
+		return nil
+	}
+
+	embeds := []label.Label{}
+	for _, src := range r.AttrStrings("srcs") {
+		if !isLabel(src) {
+			continue
+		}
+		lbl, err := label.Parse(src)
+		if err != nil {
+			continue
+		}
+		embeds = append(embeds, lbl.Abs(from.Repo, from.Pkg))
+	}
+	return embeds
+}
+
+// evalSrcs returns the files listed by a srcs expression of a rule in pkg,
+// expanding glob() calls against the files of pkg. Expressions that can't be
+// evaluated contribute no files.
+func (lang *JS) evalSrcs(expr bzl.Expr, c *config.Config, pkg string) []string {
+	switch e := expr.(type) {
+	case *bzl.StringExpr:
+		return []string{e.Value}
+	case *bzl.ListExpr:
+		srcs := make([]string, 0, len(e.List))
+		for _, item := range e.List {
+			if str, ok := item.(*bzl.StringExpr); ok {
+				srcs = append(srcs, str.Value)
+			}
+		}
+		return srcs
+	case *bzl.BinaryExpr:
+		// srcs = ["a.ts"] + glob(["lib/*.ts"])
+		if e.Op == "+" {
+			return append(lang.evalSrcs(e.X, c, pkg), lang.evalSrcs(e.Y, c, pkg)...)
+		}
+	case *bzl.CallExpr:
+		if ident, ok := e.X.(*bzl.Ident); ok && ident.Name == "glob" {
+			return lang.expandGlob(e, c, pkg)
+		}
+	}
 	return nil
 }
 
+// unevaluatedSrcs reports whether evalSrcs can't know the files of expr, like
+// a variable or a macro call
+func unevaluatedSrcs(expr bzl.Expr) bool {
+	switch e := expr.(type) {
+	case nil, *bzl.StringExpr, *bzl.ListExpr:
+		return false
+	case *bzl.BinaryExpr:
+		return unevaluatedSrcs(e.X) || unevaluatedSrcs(e.Y)
+	case *bzl.CallExpr:
+		ident, ok := e.X.(*bzl.Ident)
+		return !ok || ident.Name != "glob"
+	}
+	return true
+}
+
+// filesystemSrcs lists the source files in the directory of a rule whose srcs
+// can't be evaluated, for js_filesystem_index. Test files are only listed for
+// jest_test rules, and the files listed by the other rules of the BUILD file
+// are left to them.
+func (lang *JS) filesystemSrcs(c *config.Config, r *rule.Rule, f *rule.File) []string {
+	dir := path.Join(c.RepoRoot, f.Pkg)
+	claimed := make(map[string]bool)
+	for _, other := range f.Rules {
+		if other == r {
+			continue
+		}
+		for _, src := range lang.evalSrcs(other.Attr("srcs"), c, f.Pkg) {
+			claimed[path.Clean(src)] = true
+		}
+	}
+
+	isTest := r.Kind() == getKind(c, "jest_test")
+	srcs := make([]string, 0)
+	for _, entry := range lang.dirs.readDir(dir).entries {
+		name := entry.Name()
+		if entry.IsDir() || claimed[name] {
+			continue
+		}
+		if !tsExtensionsPattern.MatchString(name) && !jsExtensionsPattern.MatchString(name) {
+			continue
+		}
+		if jsTestExtensionsPattern.MatchString(name) || tsTestExtensionsPattern.MatchString(name) {
+			if isTest {
+				srcs = append(srcs, name)
+			}
+		} else if !isTest {
+			srcs = append(srcs, name)
+		}
+	}
+	return srcs
+}
+
+// expandGlob lists the files of pkg matching the include globs of a glob()
+// call and none of its exclude globs. Like in Bazel, globs don't descend into
+// subpackages. Each call is expanded once, through the dirCache.
+func (lang *JS) expandGlob(call *bzl.CallExpr, c *config.Config, pkg string) []string {
+	if files, ok := lang.dirs.glob(call); ok {
+		return files
+	}
+
+	var include, exclude []string
+	for i, arg := range call.List {
+		if assign, ok := arg.(*bzl.AssignExpr); ok {
+			if key, ok := assign.LHS.(*bzl.Ident); ok {
+				switch key.Name {
+				case "include":
+					include = lang.evalSrcs(assign.RHS, c, pkg)
+				case "exclude":
+					exclude = lang.evalSrcs(assign.RHS, c, pkg)
+				}
+			}
+		} else if i == 0 {
+			include = lang.evalSrcs(arg, c, pkg)
+		} else if i == 1 {
+			exclude = lang.evalSrcs(arg, c, pkg)
+		}
+	}
+
+	files := []string{}
+	if includePattern, excludePattern, ok := globPatterns(include, exclude); ok {
+		var walk func(rel string)
+		walk = func(rel string) {
+			for _, entry := range lang.dirs.readDir(path.Join(c.RepoRoot, pkg, rel)).entries {
+				name := path.Join(rel, entry.Name())
+				if entry.IsDir() {
+					if !lang.isPackageDir(c, path.Join(pkg, name)) {
+						walk(name)
+					}
+					continue
+				}
+				if includePattern.MatchString(name) && !excludePattern.MatchString(name) {
+					files = append(files, name)
+				}
+			}
+		}
+		walk("")
+	}
+	lang.dirs.setGlob(call, files)
+	return files
+}
+
+// globPatterns compiles the include and exclude globs of a glob() call
+func globPatterns(include []string, exclude []string) (*regexp.Regexp, *regexp.Regexp, bool) {
+	if len(include) == 0 {
+		return nil, nil, false
+	}
+	includePattern, err := globPattern(include)
+	if err != nil {
+		return nil, nil, false
+	}
+	excludePattern := regexp.MustCompile("$^")
+	if len(exclude) > 0 {
+		if excludePattern, err = globPattern(exclude); err != nil {
+			return nil, nil, false
+		}
+	}
+	return includePattern, excludePattern, true
+}
+
+func isLabel(src string) bool {
+	return strings.HasPrefix(src, ":") || strings.HasPrefix(src, "//") || strings.HasPrefix(src, "@")
+}
+
 // Resolve translates imported libraries for a given rule into Bazel
 // dependencies. Information about imported libraries is returned for each
 // rule generated by language.GenerateRules in
@@ -162,6 +470,21 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 	jsConfigs := c.Exts[languageName].(JsConfigs)
 	jsConfig := jsConfigs[from.Pkg]
 
+	// indexing is complete once rules are resolved
+	for _, gap := range lang.coverage.report() {
+		log.Print(Warn("[WARN] %s", gap))
+	}
+
+	if _, ok := vendorDir(jsConfig, from.Pkg); ok {
+		// vendored sources are not resolved
+		return
+	}
+
+	if jsConfig.AggregatorKinds[r.Kind()] && len(lang.evalSrcs(r.Attr("srcs"), c, from.Pkg)) == 0 {
+		// aggregators without sources keep their hand-authored deps
+		return
+	}
+
 	packageJSON := "//:package"
 	packageResolveResult := lang.tryResolve("package.json", c, ix, from)
 	if packageResolveResult.err != nil {
@@ -169,7 +492,10 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 		return
 	}
 	if packageResolveResult.selfImport {
-		// ignore self imports
+		// the package.json rule only depends on the files it lists
+		if jsConfig.IncludePkgFiles {
+			lang.resolvePackageFiles(c, ix, rc, r, _imports.(*imports), from)
+		}
 		return
 	}
 	if packageResolveResult.label != label.NoLabel {
@@ -181,50 +507,234 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 	imports := _imports.(*imports)
 	depSet := make(map[string]bool)
 	dataSet := make(map[string]bool)
-	for name := range imports.set {
+	var typeDepSet map[string]bool
+	if jsConfig.TypeDepsAttr != "" && r.Kind() == getKind(c, "ts_project") {
+		typeDepSet = make(map[string]bool)
+	}
+
+	// types packages needed by the imports, looked up once they are all known
+	typesNames := make(typesLookup)
+
+	// resolveInto adds the labels providing name to set, regardless of their kind
+	resolveInto := func(name string, set map[string]bool, reportMissing bool) {
+		if isNpm, npmLabel, _ := lang.isNpmDependency(name, jsConfig); isNpm {
+			set[npmPackageLabel(npmLabel, npmPackageName(name, jsConfig), jsConfig)] = true
+			return
+		}
+		if lang.resolveURLImport(name, set, c, jsConfig, from) {
+			return
+		}
+		if lbl, ok := externalRepoLabel(name, jsConfig); ok {
+			set[lbl.Rel(from.Repo, from.Pkg).String()] = true
+			return
+		}
+		// bare names may be resolved to any target, like a sh_binary tool
+		if !strings.HasPrefix(name, ".") {
+			if resolveResult := lang.tryResolve(name, c, ix, from); resolveResult.err == nil && !resolveResult.selfImport && resolveResult.label != label.NoLabel {
+				set[resolveResult.label.Rel(from.Repo, from.Pkg).String()] = true
+				return
+			}
+		}
+		if err := lang.resolveWalkParents(name, set, set, c, ix, rc, r, from); err != nil && (reportMissing || !isUnresolved(err)) {
+			logResolveError(err, jsConfig)
+		}
+	}
+
+	// modules located with import.meta.resolve() are resolved like imports
+	names := imports.set
+	if jsConfig.MetaResolve == "dep" && len(imports.metaResolve) > 0 {
+		names = make(map[string]bool, len(imports.set)+len(imports.metaResolve))
+		for name := range imports.set {
+			names[name] = true
+		}
+		for name := range imports.metaResolve {
+			names[name] = true
+		}
+	}
+
+	// subpath imports of a package, like lodash/map and lodash/filter, are
+	// resolved once through the package root
+	names, types := lang.collapseNpmSubpaths(names, imports.types, jsConfig)
+
+	for name := range names {
+
+		// type-only imports are only needed to compile
+		typeOnly := typeDepSet != nil && types[name]
+		importDeps := depSet
+		if typeOnly {
+			importDeps = typeDepSet
+		}
+
+		// is it declared by an ambient module declaration?
+		ambient := jsConfig.AmbientPattern.MatchString(name)
+
+		// remote and inline modules, like https://esm.sh/lodash, are not built here
+		if lang.resolveURLImport(name, importDeps, c, jsConfig, from) {
+			continue
+		}
+
+		// is it a virtual specifier of a custom loader, like my-loader:config?
+		if lbl, ok := virtualPrefix(name, jsConfig); ok {
+			if lbl != label.NoLabel && !lbl.Equal(from) {
+				dataSet[lbl.Rel(from.Repo, from.Pkg).String()] = true
+			} else if lbl == label.NoLabel && jsConfig.Verbose {
+				log.Print(Info("[%s] skipping virtual import %s", from.Abs(from.Repo, from.Pkg).String(), name))
+			}
+			continue
+		}
+
+		// does it have a loader query, like ?inline or ?url?
+		bucket := ""
+		if i := strings.Index(name, "?"); i >= 0 {
+			query := name[i+1:]
+			name = name[:i]
+			var ok bool
+			if bucket, ok = jsConfig.ImportQueries[query]; !ok {
+				bucket = "data"
+				if jsConfig.Verbose {
+					log.Print(Info("[%s] unknown query ?%s on import %s, adding to data", from.Abs(from.Repo, from.Pkg).String(), query, name))
+				}
+			}
+		}
 
 		// is it a package.json import?
 		if name == "package" || name == "package.json" {
-			depSet[packageJSON] = true
+			importDeps[packageJSON] = true
 			continue
 		}
 
+		// is it remapped by the "browser" field of package.json?
+		if remapped, ok := browserRemap(jsConfig, from.Pkg, name); ok {
+			if remapped == "" {
+				// excluded from browser builds
+				continue
+			}
+			name = remapped
+		}
+
 		// fix aliases
+		aliases := []string{}
 		match := jsConfig.ImportAliasPattern.FindStringSubmatch(name)
 		if len(match) > 0 {
 			prefix := match[0]
-			alias := ""
 			for _, impAlias := range jsConfig.ImportAliases {
 				if impAlias.From == prefix {
-					alias = impAlias.To
+					aliases = append(aliases, impAlias.To+strings.TrimPrefix(name, prefix))
+				}
+			}
+
+			name = aliases[0]
+		}
+
+		// loader queries decide the attribute regardless of what provides the import
+		if bucket == "data" {
+			resolveInto(name, dataSet, !ambient)
+			continue
+		} else if bucket == "dep" {
+			resolveInto(name, importDeps, !ambient)
+			continue
+		}
+
+		if len(aliases) > 1 {
+			// try each alias in order, using the first one that resolves
+			resolved := false
+			for _, alias := range aliases {
+				if isNpm, _, _ := lang.isNpmDependency(alias, jsConfig); isNpm {
+					// npm packages go through the classification below
+					name = alias
+					break
+				}
+				if err := lang.resolveWalkParents(alias, importDeps, dataSet, c, ix, rc, r, from); !isUnresolved(err) {
+					if err != nil {
+						logResolveError(err, jsConfig)
+					}
+					resolved = true
 					break
 				}
 			}
+			if resolved {
+				continue
+			}
+		}
+
+		// is it a builtin provided by a polyfill?
+		if polyfill, ok := jsConfig.BuiltinPolyfills[strings.TrimPrefix(name, "node:")]; ok {
+			name = polyfill
+		}
+
+		// is it mapped to another repository, like @shared/lib to @shared_repo//lib?
+		if lbl, ok := externalRepoLabel(name, jsConfig); ok {
+			importDeps[lbl.Rel(from.Repo, from.Pkg).String()] = true
+			continue
+		}
+
+		// is it a subpath import of the package, like #internal/utils?
+		if strings.HasPrefix(name, "#") {
+			target, ok := subpathImport(name, jsConfig, jsConfig.ExportConditions)
+			if !ok {
+				logResolveError(&UnresolvedImportError{Import: name, From: from}, jsConfig)
+				continue
+			}
+			name = target
+			if strings.HasPrefix(target, ".") {
+				name = relativeImport(from.Pkg, path.Join(jsConfig.PackageDir, target))
+			}
+		}
+
+		// is the package importing itself by name?
+		if target, ok := lang.packageReference(name, jsConfig, jsConfig.EntryFields, jsConfig.ExportConditions, c.RepoRoot); ok {
+			name = relativeImport(from.Pkg, target)
+		}
+
+		// is it a first-party package linked into node_modules?
+		if lbl, subpath, ok := firstPartyPackage(name, jsConfig); ok {
+			if subpath == "" {
+				if !lbl.Equal(from) {
+					importDeps[lbl.Rel(from.Repo, from.Pkg).String()] = true
+				}
+				continue
+			}
+			// subpaths are looked up in the sources of the package
+			name = relativeImport(from.Pkg, path.Join(lbl.Pkg, subpath))
+		}
+
+		// is it a workspace package, like "@myorg/shared": "workspace:*"?
+		if jsConfig.WorkspacePackages[npmPackageRoot(name)] {
+			target, ok := lang.workspaceReference(name, jsConfigs, jsConfig.EntryFields, jsConfig.ExportConditions, c.RepoRoot)
+			if !ok {
+				logResolveError(&UnresolvedImportError{Import: name, From: from}, jsConfig)
+				continue
+			}
+			name = relativeImport(from.Pkg, target)
+		}
 
-			name = alias + strings.TrimPrefix(name, prefix)
+		// is it relative to the JS root, like app/components/Button?
+		if jsConfig.ResolveFromRoot && lang.isRootImport(name, jsConfig, c.RepoRoot) {
+			name = relativeImport(from.Pkg, path.Join(jsConfig.JSRoot, name))
 		}
 
 		// is it an npm dependency?
 		isNpm, npmLabel, devDep := lang.isNpmDependency(name, jsConfig)
 		if isNpm {
 
-			s := strings.Split(name, "/")
-			name = s[0]
-			if strings.HasPrefix(name, "@") && len(s) >= 2 {
-				name += "/" + s[1]
+			subpath := name
+			name = npmPackageName(name, jsConfig)
+			// subpaths like @scope/pkg/sub use the same label in deps and data
+			dep := npmPackageLabel(npmLabel, name, jsConfig)
+			if subpath != npmPackageRoot(subpath) && lang.isWebAsset(jsConfig, subpath) {
+				// assets shipped in the package are only needed at runtime
+				dataSet[dep] = true
+				continue
 			}
-			depSet[fmt.Sprintf("%s%s", npmLabel, name)] = true
-			if !devDep {
+			importDeps[dep] = true
+			if (!devDep || jsConfig.DevDepRuntimeKinds[r.Kind()]) && !typeOnly {
 				// Runtime dependency
-				dataSet[fmt.Sprintf("%s%s", npmLabel, name)] = true
+				dataSet[dep] = true
 			}
 
-			if jsConfig.LookupTypes && r.Kind() == "ts_project" {
+			if jsConfig.LookupTypes && r.Kind() == "ts_project" && !ambient {
 				// does it have a corresponding @types/[...] declaration?
-				typesFound, npmLabel, _ := lang.isNpmDependency("@types/"+name, jsConfig)
-				if typesFound {
-					depSet[fmt.Sprintf("%s@types/%s", npmLabel, name)] = true
-				}
+				typesNames.add(typesPackage(name, jsConfig), typeOnly)
 			}
 
 			continue
@@ -232,37 +742,89 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 
 		// is it a builtin?
 		if strings.HasPrefix(name, "node:") {
-			if jsConfig.LookupTypes && r.Kind() == "ts_project" {
-				typesFound, npmLabel, _ := lang.isNpmDependency("@types/node", jsConfig)
-				if typesFound {
-					depSet[fmt.Sprintf("%s@types/node", npmLabel)] = true
-				}
+			if jsConfig.LookupTypes && jsConfig.NodeTypes && r.Kind() == "ts_project" {
+				typesNames.add(typesPackage("node", jsConfig), typeOnly)
 			}
 			continue
 		}
 		if _, ok := BUILTINS[name]; ok {
 			// add @types/node when using node.js builtin and have @types/nodes installed
-			if jsConfig.LookupTypes && r.Kind() == "ts_project" {
+			if jsConfig.LookupTypes && jsConfig.NodeTypes && r.Kind() == "ts_project" {
 				// does it have a corresponding @types/[...] declaration?
-				typesFound, npmLabel, _ := lang.isNpmDependency("@types/"+name, jsConfig)
-				if typesFound {
-					depSet[fmt.Sprintf("%s@types/%s", npmLabel, name)] = true
+				typesName, mapped := jsConfig.TypesMapping[name]
+				if !mapped {
+					// builtins share the types of node when it is mapped
+					typesName, mapped = jsConfig.TypesMapping["node"]
+				}
+				if !mapped {
+					typesName = typesPackage(name, jsConfig)
 				}
+				typesNames.add(typesName, typeOnly)
 			}
 			continue
 		}
 
+		// typed CSS modules also depend on their generated declarations
+		if jsConfig.CSSModuleTypes && r.Kind() == getKind(c, "ts_project") && cssModulePattern.MatchString(name) {
+			lang.resolveCSSModuleTypes(name, importDeps, c, ix, from)
+		}
+
 		// Is user resolved
 		resolveResult := lang.tryResolve(name, c, ix, from)
 		if resolveResult.err == nil && !resolveResult.selfImport && resolveResult.label != label.NoLabel {
 			// add discovered label
 			lbl := resolveResult.label
 			dep := lbl.Rel(from.Repo, from.Pkg).String()
-			depSet[dep] = true
+			importDeps[dep] = true
 			continue
 		}
 
-		lang.resolveWalkParents(name, depSet, dataSet, c, ix, rc, r, from)
+		err := lang.resolveWalkParentsCached(name, importDeps, dataSet, c, ix, rc, r, from)
+		if isUnresolved(err) && strings.HasPrefix(name, ".") {
+			// is it merged from another of the tsconfig rootDirs?
+			for _, candidate := range rootDirCandidates(jsConfig, path.Join(from.Pkg, name)) {
+				if rootErr := lang.resolveWalkParents(relativeImport(from.Pkg, candidate), importDeps, dataSet, c, ix, rc, r, from); !isUnresolved(rootErr) {
+					err = rootErr
+					break
+				}
+			}
+		}
+
+		// ambient declarations make imports without sources intentional
+		if err != nil && (!ambient || !isUnresolved(err)) {
+			logResolveError(err, jsConfig)
+		}
+	}
+
+	typesNames.resolve(func(typesName string) (string, bool) {
+		typesFound, npmLabel, _ := lang.isNpmDependency(typesName, jsConfig)
+		return npmPackageLabel(npmLabel, typesName, jsConfig), typesFound
+	}, depSet, typeDepSet)
+
+	// files referenced at runtime are data dependencies
+	for name := range imports.data {
+		resolveInto(name, dataSet, true)
+	}
+	if jsConfig.MetaResolve == "data" {
+		for name := range imports.metaResolve {
+			resolveInto(name, dataSet, true)
+		}
+	}
+
+	// runtime requirements that are never imported, like polyfills
+	if r.Kind() == getKind(c, "js_library") || r.Kind() == getKind(c, "ts_project") || r.Kind() == getKind(c, "jest_test") {
+		for _, name := range jsConfig.ImplicitDeps {
+			isNpm, npmLabel, devDep := lang.isNpmDependency(name, jsConfig)
+			if !isNpm {
+				logResolveError(&UnresolvedImportError{Import: name, From: from}, jsConfig)
+				continue
+			}
+			dep := npmPackageLabel(npmLabel, npmPackageName(name, jsConfig), jsConfig)
+			depSet[dep] = true
+			if !devDep || jsConfig.DevDepRuntimeKinds[r.Kind()] {
+				dataSet[dep] = true
+			}
+		}
 	}
 
 	// Add in additional jest dependencies
@@ -271,12 +833,13 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 			if name == "jest-cli" || name == "jest-junit" {
 				continue
 			}
+			dep := npmPackageLabel(npmLabel, name, jsConfig)
 			if strings.HasPrefix(name, "@types/jest") {
-				depSet[fmt.Sprintf("%s%s", npmLabel, name)] = true
+				depSet[dep] = true
 			}
 			if strings.HasPrefix(name, "jest") {
-				depSet[fmt.Sprintf("%s%s", npmLabel, name)] = true
-				dataSet[fmt.Sprintf("%s%s", npmLabel, name)] = true
+				depSet[dep] = true
+				dataSet[dep] = true
 			}
 		}
 
@@ -285,36 +848,710 @@ func (lang *JS) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.Remote
 			packageLocation = ""
 		}
 		dataSet[fmt.Sprintf("//%s:package_json", packageLocation)] = true
+
+		// manual mocks of imported modules are loaded by jest by convention
+		if jsConfig.MocksDir != "" {
+			for name := range imports.set {
+				if mock, ok := lang.manualMock(name, jsConfig, c.RepoRoot, from.Pkg); ok {
+					resolveInto(relativeImport(from.Pkg, mock), dataSet, false)
+				}
+			}
+		}
+	}
+
+	// imports into a bundle depend on the bundle target
+	depSet = bundleLabels(depSet, jsConfigs, jsConfig.Bundle, from)
+	dataSet = bundleLabels(dataSet, jsConfigs, jsConfig.Bundle, from)
+	if typeDepSet != nil {
+		typeDepSet = bundleLabels(typeDepSet, jsConfigs, jsConfig.Bundle, from)
+		// labels also needed by value imports stay in deps
+		for d := range depSet {
+			delete(typeDepSet, d)
+		}
 	}
 
-	deps := []string{}
-	for dep := range depSet {
-		deps = append(deps, dep)
+	if jsConfig.NoDataKinds[r.Kind()] {
+		// fold runtime dependencies into deps
+		for d := range dataSet {
+			depSet[d] = true
+		}
+		dataSet = make(map[string]bool)
+	}
+
+	deps := formatLabels(depSet, jsConfig.LabelStyle, from)
+	data := formatLabels(dataSet, jsConfig.LabelStyle, from)
+	typeDeps := formatLabels(typeDepSet, jsConfig.LabelStyle, from)
+
+	if jsConfig.GraphExport != "" {
+		lang.graph.add(filepath.Join(c.RepoRoot, jsConfig.GraphExport), depGraphNode{
+			Label:    from.String(),
+			Kind:     r.Kind(),
+			Deps:     graphLabels(depSet, from),
+			Data:     graphLabels(dataSet, from),
+			TypeDeps: graphLabels(typeDepSet, from),
+		})
+	}
+
+	// many deps may be a sign of a broad rule, or of a wrong resolution
+	if jsConfig.MaxDepsWarn >= 0 && len(deps) > jsConfig.MaxDepsWarn && !jsConfig.Quiet {
+		log.Print(Warn("[%s] has %d deps, more than the %d allowed by js_max_deps_warn", from.Abs(from.Repo, from.Pkg).String(), len(deps), jsConfig.MaxDepsWarn))
+	}
+
+	if jsConfig.PrintOnly {
+		// report computed attributes without modifying the rule
+		sort.Strings(deps)
+		sort.Strings(data)
+		if typeDepSet != nil {
+			sort.Strings(typeDeps)
+			log.Print(Info("%s -> {deps: %v, data: %v, %s: %v}", from.Abs(from.Repo, from.Pkg).String(), deps, data, jsConfig.TypeDepsAttr, typeDeps))
+			return
+		}
+		log.Print(Info("%s -> {deps: %v, data: %v}", from.Abs(from.Repo, from.Pkg).String(), deps, data))
+		return
 	}
+
+	// kinds with externally managed deps keep them when none are found
+	preserve := jsConfig.PreserveEmptyDeps[r.Kind()]
+
 	if len(deps) > 0 {
 		r.SetAttr("deps", deps)
-	} else {
+	} else if !preserve {
 		r.DelAttr("deps")
 	}
 
-	data := []string{}
-	for d := range dataSet {
-		data = append(data, d)
-	}
 	if len(data) > 0 {
 		r.SetAttr("data", data)
-	} else {
+	} else if !preserve {
 		r.DelAttr("data")
 	}
+	if typeDepSet != nil {
+		if len(typeDeps) > 0 {
+			r.SetAttr(jsConfig.TypeDepsAttr, typeDeps)
+		} else if !preserve {
+			r.DelAttr(jsConfig.TypeDepsAttr)
+		}
+	}
 }
 
-func (lang *JS) resolveWalkParents(name string, depSet map[string]bool, dataSet map[string]bool, c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, from label.Label) {
+// resolvePackageFiles sets the data of the package.json rule to the rules
+// providing the files listed by its "bin" and "files", see
+// js_include_pkg_files.
+func (lang *JS) resolvePackageFiles(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports *imports, from label.Label) {
+	jsConfig := c.Exts[languageName].(JsConfigs)[from.Pkg]
+	dataSet := make(map[string]bool)
+	for name := range imports.data {
+		if err := lang.resolveWalkParents(name, dataSet, dataSet, c, ix, rc, r, from); err != nil {
+			logResolveError(err, jsConfig)
+		}
+	}
+	if data := formatLabels(dataSet, jsConfig.LabelStyle, from); len(data) > 0 {
+		r.SetAttr("data", data)
+	} else {
+		r.DelAttr("data")
+	}
+}
 
-	jsConfigs := c.Exts[languageName].(JsConfigs)
-	jsConfig := jsConfigs[from.Pkg]
+// selfReference returns the repo relative path a package's import of its own
+// name points at, mapped through the "exports" of its package.json as
+// selected by the active conditions.
+func selfReference(imp string, jsConfig *JsConfig, conditions []string) (string, bool) {
+	if jsConfig.PackageName == "" {
+		return "", false
+	}
+	subpath := "."
+	if imp != jsConfig.PackageName {
+		rest := strings.TrimPrefix(imp, jsConfig.PackageName+"/")
+		if rest == imp {
+			return "", false
+		}
+		subpath = "./" + rest
+	}
 
-	parents := ""
+	exports := jsConfig.PackageExports
+	if len(conditions) > 0 {
+		exports = readPackageExports(jsConfig.PackageExportsRaw, conditions)
+		if _, ok := exports["."]; !ok {
+			// like the "main" field
+			if target, ok := jsConfig.PackageExports["."]; ok {
+				exports["."] = target
+			}
+		}
+	}
+	if target, ok := matchSubpath(exports, subpath); ok {
+		if target == "" {
+			// blocked with null
+			return "", false
+		}
+		return path.Join(jsConfig.PackageDir, target), true
+	}
+	if hasExports(jsConfig) {
+		// subpaths missing from the "exports" can't be imported
+		return "", false
+	}
+
+	// without "exports", subpaths are files of the package
+	if subpath == "." {
+		subpath = "index"
+	}
+	return path.Join(jsConfig.PackageDir, subpath), true
+}
+
+// subpathImport returns what a subpath import, like #internal/utils, maps to
+// through the "imports" of the nearest package.json as selected by the active
+// conditions: a file of the package, like ./src/internal/utils.ts, or the
+// name of another package.
+func subpathImport(imp string, jsConfig *JsConfig, conditions []string) (string, bool) {
+	return matchSubpath(readPackageImports(jsConfig.PackageImportsRaw, conditions), imp)
+}
+
+// hasExports reports whether the package.json of jsConfig has an "exports"
+// field, which then lists every subpath that can be imported.
+func hasExports(jsConfig *JsConfig) bool {
+	raw := strings.TrimSpace(string(jsConfig.PackageExportsRaw))
+	return raw != "" && raw != "null"
+}
+
+// matchSubpath returns the target of subpath in the flattened "exports" or
+// "imports" of a package.json, expanding patterns like "./*": "./src/*.ts".
+// The pattern with the longest prefix wins, like Node, and blocked subpaths
+// have an empty target.
+func matchSubpath(entries map[string]string, subpath string) (string, bool) {
+	if target, ok := entries[subpath]; ok {
+		return target, true
+	}
+	matchPrefix, matchTarget, found := "", "", false
+	for pattern, target := range entries {
+		prefix, suffix, ok := strings.Cut(pattern, "*")
+		if !ok || !strings.HasPrefix(subpath, prefix) || !strings.HasSuffix(subpath, suffix) || len(subpath) < len(prefix)+len(suffix) {
+			continue
+		}
+		if found && len(prefix) <= len(matchPrefix) {
+			continue
+		}
+		match := subpath[len(prefix) : len(subpath)-len(suffix)]
+		matchPrefix, matchTarget, found = prefix, strings.Replace(target, "*", match, -1), true
+	}
+	return matchTarget, found
+}
+
+// virtualPrefix returns the label the longest js_virtual_prefix matching imp
+// maps to, label.NoLabel when the prefix is skipped.
+func virtualPrefix(imp string, jsConfig *JsConfig) (label.Label, bool) {
+	match := ""
+	for prefix := range jsConfig.VirtualPrefixes {
+		if strings.HasPrefix(imp, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return label.NoLabel, false
+	}
+	return jsConfig.VirtualPrefixes[match], true
+}
+
+// externalRepoLabel returns the label an import maps to through the longest
+// matching js_external_repo prefix, keeping the rest of the import as the
+// package, like @shared/lib/format to @shared_repo//lib/format.
+func externalRepoLabel(imp string, jsConfig *JsConfig) (label.Label, bool) {
+	match := ""
+	for prefix := range jsConfig.ExternalRepos {
+		if strings.HasPrefix(imp, prefix) && len(prefix) > len(match) {
+			match = prefix
+		}
+	}
+	if match == "" {
+		return label.NoLabel, false
+	}
+	lbl, err := label.Parse(strings.TrimSuffix(jsConfig.ExternalRepos[match]+strings.TrimPrefix(imp, match), "/"))
+	if err != nil {
+		return label.NoLabel, false
+	}
+	return lbl, true
+}
+
+// firstPartyPackage returns the label of the in-repo package a bare import
+// names according to js_first_party, and the subpath imported from it.
+func firstPartyPackage(imp string, jsConfig *JsConfig) (label.Label, string, bool) {
+	root := npmPackageRoot(imp)
+	lbl, ok := jsConfig.FirstParty[root]
+	if !ok {
+		return label.NoLabel, "", false
+	}
+	return lbl, strings.TrimPrefix(strings.TrimPrefix(imp, root), "/"), true
+}
+
+// packageReference returns the sources an import of the package described by
+// jsConfig names, see selfReference. An import of the package name uses the
+// first of the entryFields it has, like "module", over its exports. When the
+// root export only names build outputs, like {"import": "./esm/index.js"},
+// the package itself is used.
+func (lang *JS) packageReference(imp string, jsConfig *JsConfig, entryFields []string, conditions []string, repoRoot string) (string, bool) {
+	target, ok := selfReference(imp, jsConfig, conditions)
+	if !ok {
+		return "", false
+	}
+	if imp == jsConfig.PackageName {
+		for _, field := range entryFields {
+			if entry, ok := jsConfig.PackageEntries[field]; ok {
+				target = path.Join(jsConfig.PackageDir, entry)
+				break
+			}
+		}
+	}
+	if exists, _ := lang.dirs.stat(repoRoot, target); !exists && imp == jsConfig.PackageName && path.Ext(target) != "" {
+		return jsConfig.PackageDir, true
+	}
+	return target, true
+}
+
+// workspaceReference returns the sources an import of a workspace package
+// names, using the package file read in the directory of that package.
+func (lang *JS) workspaceReference(imp string, jsConfigs JsConfigs, entryFields []string, conditions []string, repoRoot string) (string, bool) {
+	pkg, ok := lang.workspaceDirs[npmPackageRoot(imp)]
+	if !ok {
+		return "", false
+	}
+	return lang.packageReference(imp, jsConfigs[pkg], entryFields, conditions, repoRoot)
+}
+
+// isRootImport reports whether a bare import, like app/components/Button,
+// names a file or directory under the JS root. npm packages of the package
+// file and @ prefixed imports are never relative to the root.
+func (lang *JS) isRootImport(imp string, jsConfig *JsConfig, repoRoot string) bool {
+	if strings.HasPrefix(imp, ".") || strings.HasPrefix(imp, "/") || strings.HasPrefix(imp, "@") {
+		return false
+	}
+	if isNpm, _, _ := lang.isNpmDependency(imp, jsConfig); isNpm {
+		return false
+	}
+	target := normalizePath(jsConfig.JSRoot, imp)
+	for _, ext := range append([]string{""}, sourceExtensions(jsConfig, nil)...) {
+		if exists, _ := lang.dirs.stat(repoRoot, target+ext); exists {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeImport rewrites the repo relative target as an import relative to pkg
+func relativeImport(pkg string, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(pkg), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." || strings.HasPrefix(rel, "../") || rel == ".." {
+		return rel
+	}
+	return "./" + rel
+}
+
+// sourcePath maps a path inside of an output directory of js_outdir_map to
+// the source directory it is built from, like dist/foo.js to src/foo.
+// Compiled extensions are dropped, so that the sources are tried instead.
+// The longest matching output directory wins, like dist/types over dist.
+func sourcePath(jsConfig *JsConfig, target string) string {
+	match := ""
+	for outDir := range jsConfig.OutDirs {
+		if (target == outDir || strings.HasPrefix(target, outDir+"/")) && len(outDir) > len(match) {
+			match = outDir
+		}
+	}
+	if match == "" {
+		return target
+	}
+	target = normalizePath(jsConfig.OutDirs[match], strings.TrimPrefix(target, match))
+	if strings.HasSuffix(target, ".d.ts") {
+		return strings.TrimSuffix(target, ".d.ts")
+	}
+	if jsExtensionsPattern.MatchString(target) || jsModuleExtensionsPattern.MatchString(target) {
+		return strings.TrimSuffix(target, path.Ext(target))
+	}
+	return target
+}
+
+// manualMock returns the jest manual mock of an import of pkg, if any. Mocks
+// of local modules are in the mocks directory next to the module, like
+// api/__mocks__/client.ts for ./api/client, and mocks of npm packages are in
+// the mocks directory of the JS root, like __mocks__/axios.ts.
+func (lang *JS) manualMock(imp string, jsConfig *JsConfig, repoRoot string, pkg string) (string, bool) {
+	var base string
+	if strings.HasPrefix(imp, ".") {
+		target := path.Join(pkg, imp)
+		base = path.Join(path.Dir(target), jsConfig.MocksDir, path.Base(target))
+	} else if isNpm, _, _ := lang.isNpmDependency(imp, jsConfig); isNpm {
+		base = path.Join(jsConfig.JSRoot, jsConfig.MocksDir, imp)
+	} else {
+		return "", false
+	}
+	for _, ext := range append(append([]string{}, tsExtensions...), jsExtensions...) {
+		if exists, isDir := lang.dirs.stat(repoRoot, base+ext); exists && !isDir {
+			return base + ext, true
+		}
+	}
+	return "", false
+}
+
+var cssModulePattern = regexp.MustCompile(`^\.\.?/.*\.module\.(css|scss|sass|less)$`)
+
+// resolveCSSModuleTypes adds the declaration of a relative CSS module import
+// to depSet, like the rule of ./a.module.css.d.ts for ./a.module.css, if it
+// exists.
+func (lang *JS) resolveCSSModuleTypes(name string, depSet map[string]bool, c *config.Config, ix *resolve.RuleIndex, from label.Label) {
+	target := normalizePath(from.Pkg, name+".d.ts")
+	resolveResult := lang.tryResolve(target, c, ix, from)
+	if resolveResult.err != nil || resolveResult.selfImport {
+		return
+	}
+	if resolveResult.label != label.NoLabel {
+		depSet[resolveResult.label.Rel(from.Repo, from.Pkg).String()] = true
+	} else if resolveResult.fileName != "" {
+		depSet[fmt.Sprintf("//%s:%s", path.Dir(target), resolveResult.fileName)] = true
+	}
+}
+
+// generatingRule returns the rule of another language generating the sources
+// of target, according to js_gen_suffix. With _pb=proto, foo_pb and foo_pb.ts
+// are generated by the proto rule indexing foo.proto.
+func (lang *JS) generatingRule(target string, c *config.Config, ix *resolve.RuleIndex, jsConfig *JsConfig) (label.Label, bool) {
+	base := trimSourceExtension(target)
+	suffix := ""
+	for s := range jsConfig.GenSuffixes {
+		if strings.HasSuffix(base, s) && len(s) > len(suffix) {
+			suffix = s
+		}
+	}
+	if suffix == "" {
+		return label.NoLabel, false
+	}
+
+	genLang := jsConfig.GenSuffixes[suffix]
+	importSpec := resolve.ImportSpec{
+		Lang: genLang,
+		Imp:  strings.TrimSuffix(base, suffix) + "." + genLang,
+	}
+	if override, ok := resolve.FindRuleWithOverride(c, importSpec, lang.Name()); ok {
+		return override, true
+	}
+	if matches := ix.FindRulesByImportWithConfig(c, importSpec, genLang); len(matches) == 1 {
+		return matches[0].Label, true
+	}
+	return label.NoLabel, false
+}
+
+// trimSourceExtension drops the js or ts extension of a file path, if any
+func trimSourceExtension(filePath string) string {
+	if tsExtensionsPattern.MatchString(filePath) || jsExtensionsPattern.MatchString(filePath) || jsModuleExtensionsPattern.MatchString(filePath) {
+		return strings.TrimSuffix(filePath, path.Ext(filePath))
+	}
+	return filePath
+}
+
+// browserRemap applies the "browser" field of the package.json of the
+// importing package to imp when js_browser_map is enabled. Excluded modules
+// are remapped to "".
+func browserRemap(jsConfig *JsConfig, pkg string, imp string) (string, bool) {
+	if !jsConfig.BrowserMap {
+		return imp, false
+	}
+	key := imp
+	if strings.HasPrefix(imp, ".") {
+		key = trimSourceExtension(path.Join(pkg, imp))
+	}
+	to, ok := jsConfig.BrowserRemaps[key]
+	if !ok {
+		return imp, false
+	}
+	if strings.HasPrefix(to, ".") {
+		to = relativeImport(pkg, path.Join(jsConfig.PackageDir, to))
+	}
+	return to, true
+}
+
+// referencedProject returns the directory of the tsconfig project reference
+// containing target, if any
+func referencedProject(jsConfig *JsConfig, target string) (string, bool) {
+	for _, dir := range jsConfig.ProjectReferences {
+		if dir != "" && dir != "." && (target == dir || strings.HasPrefix(target, dir+"/")) {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// rootDirCandidates returns the paths target has in the other tsconfig
+// rootDirs than the one containing it, like generated/src/api for src/api
+// with "rootDirs": ["src", "generated/src"].
+func rootDirCandidates(jsConfig *JsConfig, target string) []string {
+	target = normalizePath(target)
+	rel, own := "", ""
+	found := false
+	for _, dir := range jsConfig.RootDirs {
+		if dir == "" || target == dir || strings.HasPrefix(target, dir+"/") {
+			// the deepest root dir contains target
+			if !found || len(dir) > len(own) {
+				rel, own, found = strings.TrimPrefix(strings.TrimPrefix(target, dir), "/"), dir, true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	candidates := make([]string, 0, len(jsConfig.RootDirs)-1)
+	for _, dir := range jsConfig.RootDirs {
+		if dir != own {
+			candidates = append(candidates, normalizePath(dir, rel))
+		}
+	}
+	return candidates
+}
+
+// vendorDir returns the vendor dir containing target, if any
+func vendorDir(jsConfig *JsConfig, target string) (string, bool) {
+	for _, dir := range jsConfig.VendorDirs {
+		if target == dir || strings.HasPrefix(target, dir+"/") {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// npmPackageRoot returns the package an npm import is provided by, ie
+// "@scope/pkg/sub/path" -> "@scope/pkg"
+func npmPackageRoot(imp string) string {
+	s := strings.Split(imp, "/")
+	root := s[0]
+	if strings.HasPrefix(root, "@") && len(s) >= 2 {
+		root += "/" + s[1]
+	}
+	return root
+}
+
+// collapseNpmSubpaths replaces the subpath imports of npm packages of the
+// package file with the package root, which is type-only when all of its
+// imports are. Asset subpaths, loader queries, aliases, self references and
+// first-party packages are kept as is.
+func (lang *JS) collapseNpmSubpaths(names map[string]bool, types map[string]bool, jsConfig *JsConfig) (map[string]bool, map[string]bool) {
+	collapsed := make(map[string]bool, len(names))
+	collapsedTypes := make(map[string]bool, len(types))
+	valueRoots := make(map[string]bool)
+	for name := range names {
+		root := npmPackageRoot(name)
+		if root != name && !lang.npmSubpath(name, root, jsConfig) {
+			root = name
+		}
+		collapsed[root] = true
+		if types[name] {
+			collapsedTypes[root] = true
+		} else {
+			valueRoots[root] = true
+		}
+	}
+	for root := range valueRoots {
+		delete(collapsedTypes, root)
+	}
+	return collapsed, collapsedTypes
+}
+
+// npmSubpath reports whether name is a subpath of root, a package listed in
+// the package file, that resolves like root itself.
+func (lang *JS) npmSubpath(name string, root string, jsConfig *JsConfig) bool {
+	_, dep := jsConfig.NpmDependencies.Dependencies[root]
+	_, devDep := jsConfig.NpmDependencies.DevDependencies[root]
+	if !dep && !devDep {
+		return false
+	}
+	if _, firstParty := jsConfig.FirstParty[root]; firstParty || root == jsConfig.PackageName {
+		return false
+	}
+	return !strings.Contains(name, "?") && !jsConfig.ImportAliasPattern.MatchString(name) && !lang.isWebAsset(jsConfig, name)
+}
+
+// npmPackageLabel returns the label of the npm package pkg, applying the
+// js_npm_label_suffix template to the label prefix of its package file. In
+// the target part of the template, {name} is the package name without scope.
+func npmPackageLabel(npmLabel string, pkg string, jsConfig *JsConfig) string {
+	suffix, target, hasTarget := strings.Cut(jsConfig.NpmLabelSuffix, ":")
+	npmLabel += strings.ReplaceAll(suffix, "{name}", pkg)
+	if hasTarget {
+		npmLabel += ":" + strings.ReplaceAll(target, "{name}", path.Base(pkg))
+	}
+	return npmLabel
+}
+
+// npmPackageName returns the package installed for an npm import, following
+// package.json aliases like "my-react": "npm:react@^18"
+func npmPackageName(imp string, jsConfig *JsConfig) string {
+	root := npmPackageRoot(imp)
+	if pkg, ok := jsConfig.NpmAliases[root]; ok {
+		return pkg
+	}
+	return root
+}
+
+// bundleLabels replaces the labels of rules inside another bundle than the
+// one of the importing rule with the label of that bundle.
+func bundleLabels(set map[string]bool, jsConfigs JsConfigs, bundle label.Label, from label.Label) map[string]bool {
+	bundled := make(map[string]bool, len(set))
+	for l := range set {
+		lbl, err := label.Parse(l)
+		if err != nil {
+			bundled[l] = true
+			continue
+		}
+		lbl = lbl.Abs(from.Repo, from.Pkg)
+		target, ok := jsConfigs[lbl.Pkg]
+		if !ok || lbl.Repo != from.Repo || target.Bundle == label.NoLabel || target.Bundle.Equal(bundle) {
+			bundled[l] = true
+			continue
+		}
+		if !target.Bundle.Equal(from) {
+			bundled[target.Bundle.Rel(from.Repo, from.Pkg).String()] = true
+		}
+	}
+	return bundled
+}
+
+// formatLabels renders the labels in set according to style. With "absolute"
+// every label in the main repo is written as //pkg:name, with "relative"
+// labels are written relative to the package of from where possible.
+// Otherwise labels are returned as they were resolved.
+func formatLabels(set map[string]bool, style string, from label.Label) []string {
+	formatted := make(map[string]bool)
+	for l := range set {
+		if style != "" {
+			if lbl, err := label.Parse(l); err == nil {
+				switch style {
+				case "absolute":
+					l = lbl.Abs(from.Repo, from.Pkg).String()
+				case "relative":
+					l = lbl.Abs(from.Repo, from.Pkg).Rel(from.Repo, from.Pkg).String()
+				}
+			}
+		}
+		formatted[l] = true
+	}
+
+	labels := []string{}
+	for l := range formatted {
+		labels = append(labels, l)
+	}
+	return labels
+}
+
+// sourceExtensions returns the extensions tried for an import without one,
+// in order of preference. Unless js_extension_priority is set, the importing
+// rule decides: rules of js sources prefer foo.js over foo.ts, and other rules
+// foo.ts over foo.js.
+func sourceExtensions(jsConfig *JsConfig, r *rule.Rule) []string {
+	priority := jsConfig.ExtensionPriority
+	if len(priority) == 0 {
+		priority = []string{"ts", "js"}
+		if isJSConsumer(r) {
+			priority = []string{"js", "ts"}
+		}
+	}
+	// languages missing from the priority are tried last
+	extensions := make([]string, 0, len(tsExtensions)+len(jsExtensions)+1)
+	seen := make(map[string]bool)
+	for _, lang := range append(append([]string{}, priority...), "ts", "js") {
+		if seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		if lang == "ts" {
+			extensions = append(extensions, tsExtensions...)
+		} else {
+			extensions = append(extensions, jsExtensions...)
+		}
+	}
+	// declaration files are tried last, like types.d.ts for ./types
+	return append(extensions, ".d.ts")
+}
+
+// isJSConsumer reports whether the sources of a rule are js files only
+func isJSConsumer(r *rule.Rule) bool {
+	if r == nil {
+		return false
+	}
+	srcs := r.AttrStrings("srcs")
+	for _, src := range srcs {
+		if tsExtensionsPattern.MatchString(src) {
+			return false
+		}
+	}
+	for _, src := range srcs {
+		if jsExtensionsPattern.MatchString(src) || jsModuleExtensionsPattern.MatchString(src) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnAmbiguousExtensions warns when other source files share the basename of
+// the file an import was resolved to, like foo.js next to foo.ts.
+func (lang *JS) warnAmbiguousExtensions(target string, resolved string, extensions []string, c *config.Config, from label.Label) {
+	others := make([]string, 0)
+	for _, ext := range extensions {
+		if ext == "" || ext == resolved {
+			continue
+		}
+		if exists, isDir := lang.dirs.stat(c.RepoRoot, normalizePath(target+ext)); exists && !isDir {
+			others = append(others, path.Base(target+ext))
+		}
+	}
+	if len(others) > 0 {
+		log.Print(Warn("[%s] import %s resolved to %s, ignoring %s", from.Abs(from.Repo, from.Pkg).String(), target, path.Base(target+resolved), strings.Join(others, ", ")))
+	}
+}
+
+// resolveWalkParentsCached is resolveWalkParents, looked up in the
+// js_resolve_cache of previous runs first. Only imports that resolve without
+// errors are cached.
+func (lang *JS) resolveWalkParentsCached(name string, depSet map[string]bool, dataSet map[string]bool, c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, from label.Label) error {
+	jsConfig := c.Exts[languageName].(JsConfigs)[from.Pkg]
+	if jsConfig.ResolveCache == "" || !lang.cache.open(filepath.Join(c.RepoRoot, jsConfig.ResolveCache)) {
+		return lang.resolveWalkParents(name, depSet, dataSet, c, ix, rc, r, from)
+	}
+
+	key := fmt.Sprintf("%s %s %t %s", from.Pkg, r.Kind(), isJSConsumer(r), name)
+	if entry, ok := lang.cache.get(key); ok {
+		for _, dep := range entry.Deps {
+			depSet[dep] = true
+		}
+		for _, dep := range entry.Data {
+			dataSet[dep] = true
+		}
+		return nil
+	}
+
+	deps := make(map[string]bool)
+	data := make(map[string]bool)
+	err := lang.resolveWalkParents(name, deps, data, c, ix, rc, r, from)
+	for dep := range deps {
+		depSet[dep] = true
+	}
+	for dep := range data {
+		dataSet[dep] = true
+	}
+	if err == nil {
+		lang.cache.put(key, deps, data)
+	}
+	return err
+}
+
+// resolveWalkParents resolves name by searching the package and its parents
+// up to the JS root. An *UnresolvedImportError is returned when the import
+// could not be resolved.
+func (lang *JS) resolveWalkParents(name string, depSet map[string]bool, dataSet map[string]bool, c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, from label.Label) error {
+
+	jsConfigs := c.Exts[languageName].(JsConfigs)
+	jsConfig := jsConfigs[from.Pkg]
+
+	parents := ""
 	tries := []string{}
+	// the first directory found for the import, when it has no barrel
+	dir := ""
 
 	for {
 
@@ -325,13 +1562,33 @@ func (lang *JS) resolveWalkParents(name string, depSet map[string]bool, dataSet
 			name = "index"
 		}
 
-		localDir := path.Join(from.Pkg, parents)
-		target := path.Join(localDir, name)
+		// both sides of the JS root comparison are cleaned, so that the root
+		// package is "." rather than ""
+		localDir := path.Clean(path.Join(from.Pkg, parents))
+		target := normalizePath(localDir, name)
+		target = sourcePath(jsConfig, target)
+
+		// is the directory provided by a generated barrel?
+		if lbl, ok := jsConfig.GeneratedBarrels[target]; ok {
+			if lbl.Equal(from) {
+				// ignore self imports
+				return nil
+			}
+			depSet[lbl.Rel(from.Repo, from.Pkg).String()] = true
+			return nil
+		}
+
+		// is it inside a vendor dir?
+		if dir, ok := vendorDir(jsConfig, target); ok {
+			depSet[label.New("", dir, path.Base(dir)).Rel(from.Repo, from.Pkg).String()] = true
+			return nil
+		}
 
-		// add supported extensions to target name to get a filePath
+		// add supported extensions to target name to get a filePath, unless
+		// the import already names a source file, like "./utils/index.ts"
 		extraExtensionsToTry := []string{""}
-		if !lang.isWebAsset(jsConfig, target) {
-			extraExtensionsToTry = append(append(extraExtensionsToTry, tsExtensions...), jsExtensions...)
+		if !lang.isWebAsset(jsConfig, target) && !sourceFilePattern.MatchString(target) {
+			extraExtensionsToTry = append(extraExtensionsToTry, sourceExtensions(jsConfig, r)...)
 		}
 
 		for _, ext := range extraExtensionsToTry {
@@ -339,49 +1596,83 @@ func (lang *JS) resolveWalkParents(name string, depSet map[string]bool, dataSet
 			filePath := target + ext
 			tries = append(tries, filePath)
 
+			// is the file an asset provided by a filegroup?
+			isCode := sourceFilePattern.MatchString(filePath)
+			if ext == "" && !isCode {
+				if lbl, ok := lang.findAssetRule(filePath, c, ix, from); ok {
+					if !lbl.Equal(from) {
+						dataSet[lbl.Rel(from.Repo, from.Pkg).String()] = true
+					}
+					return nil
+				}
+			}
+
+			if ext == "" && dir == "" {
+				if _, isDir := lang.dirs.stat(c.RepoRoot, normalizePath(filePath)); isDir {
+					dir = normalizePath(filePath)
+				}
+			}
+
 			// try to find a rule providing the filePath
 			resolveResult := lang.tryResolve(filePath, c, ix, from)
 			if resolveResult.err != nil {
-				log.Print(Err("%v", resolveResult.err))
-				return
+				return resolveResult.err
 			}
 			if resolveResult.selfImport {
 				// ignore self imports
-				return
+				return nil
 			}
 			if resolveResult.label != label.NoLabel {
 				// add discovered label
 				lbl := resolveResult.label
 				dep := lbl.Rel(from.Repo, from.Pkg).String()
-				if !lang.isWebAsset(jsConfig, filePath) {
+				if ext != "" && jsConfig.Verbose {
+					lang.warnAmbiguousExtensions(target, ext, extraExtensionsToTry, c, from)
+				}
+				if !lang.isWebAsset(jsConfig, filePath) || isStylesheetImport(c, r, filePath) {
 					depSet[dep] = true
 				} else {
 					dataSet[dep] = true
 				}
-				return
+				return nil
 			}
 			if resolveResult.fileName != "" {
 				// add discovered file
 				pkgName := path.Dir(target)
 				data := fmt.Sprintf("//%s:%s", pkgName, resolveResult.fileName)
 				dataSet[data] = true
-				return
+				return nil
 			}
 
 		}
 
-		if jsConfig.JSRoot == localDir || localDir == "." {
-			// unable to resolve import
-			if !jsConfig.Quiet {
-				log.Print(Err("[%s] import %v not found", from.Abs(from.Repo, from.Pkg).String(), name))
+		// is it inside a referenced project, like one of its build outputs?
+		if dir, ok := referencedProject(jsConfig, target); ok {
+			lbl := label.New("", dir, path.Base(dir))
+			if lbl.Equal(from) {
+				return nil
 			}
-			if jsConfig.Verbose {
-				log.Print(Warn("tried node_modules/%s", name))
-				for _, try := range tries {
-					log.Print(Warn("tried %s", try))
-				}
+			if lang.providesDirFile(lbl, dir, c, jsConfig, ix, from) {
+				depSet[lbl.Rel(from.Repo, from.Pkg).String()] = true
+				return nil
+			}
+			return &UnresolvedImportError{
+				Import: name,
+				From:   from,
+				Tries:  tries,
+			}
+		}
+
+		if path.Clean(jsConfig.JSRoot) == localDir || localDir == "." {
+			if dir != "" {
+				return lang.resolveDirImport(name, dir, depSet, tries, c, ix, from)
+			}
+			// unable to resolve import
+			return &UnresolvedImportError{
+				Import: name,
+				From:   from,
+				Tries:  tries,
 			}
-			return
 		}
 
 		// continue to search one directory higher
@@ -390,8 +1681,159 @@ func (lang *JS) resolveWalkParents(name string, depSet map[string]bool, dataSet
 
 }
 
+// ignoredForResolution reports whether filePath, a candidate for the import
+// target, has one of the js_resolve_ignored_suffixes in its compound extension,
+// like foo.test.ts, without target naming it. Only the glob fallback checks
+// it: extensions are tried after the whole import, so ./foo never matches
+// foo.test.ts.
+func ignoredForResolution(jsConfig *JsConfig, target string, filePath string) bool {
+	stem := trimSourceExtension(filePath)
+	for _, suffix := range jsConfig.IgnoredSuffixes {
+		if strings.HasSuffix(stem, suffix) && !strings.HasSuffix(trimSourceExtension(target), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDirImport applies js_dir_import_fallback to an import of dir, a
+// directory without a barrel. filegroup depends on the default target of dir,
+// when it provides one of the files of dir, and glob on every rule providing
+// a source file below it.
+func (lang *JS) resolveDirImport(name string, dir string, depSet map[string]bool, tries []string, c *config.Config, ix *resolve.RuleIndex, from label.Label) error {
+
+	jsConfig := c.Exts[languageName].(JsConfigs)[from.Pkg]
+
+	switch jsConfig.DirImportFallback {
+	case "filegroup":
+		lbl := label.New("", dir, path.Base(dir))
+		if lbl.Equal(from) {
+			return nil
+		}
+		if lang.providesDirFile(lbl, dir, c, jsConfig, ix, from) {
+			depSet[lbl.Rel(from.Repo, from.Pkg).String()] = true
+			return nil
+		}
+
+	case "glob":
+		found := false
+		err := lang.walkDirFiles(c, jsConfig, dir, func(filePath string) error {
+			if !sourceFilePattern.MatchString(filePath) || ignoredForResolution(jsConfig, dir, filePath) {
+				return nil
+			}
+			resolveResult := lang.tryResolve(filePath, c, ix, from)
+			if resolveResult.err != nil {
+				return resolveResult.err
+			}
+			if resolveResult.selfImport {
+				found = true
+			} else if resolveResult.label != label.NoLabel {
+				depSet[resolveResult.label.Rel(from.Repo, from.Pkg).String()] = true
+				found = true
+			}
+			return nil
+		})
+		if err != nil || found {
+			return err
+		}
+	}
+
+	return &UnresolvedImportError{
+		Import: name,
+		From:   from,
+		Tries:  tries,
+		Dir:    dir,
+	}
+}
+
+// providesDirFile reports whether the index has lbl providing one of the
+// files below dir.
+func (lang *JS) providesDirFile(lbl label.Label, dir string, c *config.Config, jsConfig *JsConfig, ix *resolve.RuleIndex, from label.Label) bool {
+	found := false
+	lang.walkDirFiles(c, jsConfig, dir, func(filePath string) error {
+		if asset, ok := lang.findAssetRule(filePath, c, ix, from); ok && asset.Equal(lbl) {
+			found = true
+		} else if resolveResult := lang.tryResolve(filePath, c, ix, from); resolveResult.err == nil && resolveResult.label.Equal(lbl) {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// walkDirFiles calls fn with the files below dir, skipping excluded files,
+// node_modules and subdirectories with a build file of their own.
+func (lang *JS) walkDirFiles(c *config.Config, jsConfig *JsConfig, dir string, fn func(filePath string) error) error {
+	for _, entry := range lang.dirs.readDir(path.Join(c.RepoRoot, dir)).entries {
+		filePath := path.Join(dir, entry.Name())
+		if jsConfig.ExclusionPattern.MatchString(filePath) {
+			continue
+		}
+		if !entry.IsDir() {
+			if err := fn(filePath); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name() == "node_modules" || lang.isPackageDir(c, filePath) {
+			continue
+		}
+		if err := lang.walkDirFiles(c, jsConfig, filePath, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPackageDir reports whether dir has a build file, making it a package
+func (lang *JS) isPackageDir(c *config.Config, dir string) bool {
+	listing := lang.dirs.readDir(path.Join(c.RepoRoot, dir))
+	for _, name := range c.ValidBuildFileNames {
+		if entry, ok := listing.byName[name]; ok && !entry.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// urlImportPattern matches the schemes of URL imports, see resolveURLImport
+var urlImportPattern = regexp.MustCompile(`^(?:https?|data|blob):`)
+
+// resolveURLImport reports whether imp is a URL, like https://esm.sh/lodash or
+// data:text/javascript,..., adding its resolve override to set if it has one.
+// URL imports are otherwise skipped.
+func (lang *JS) resolveURLImport(imp string, set map[string]bool, c *config.Config, jsConfig *JsConfig, from label.Label) bool {
+	if !urlImportPattern.MatchString(imp) {
+		return false
+	}
+	importSpec := resolve.ImportSpec{Lang: lang.Name(), Imp: imp}
+	if override, ok := resolve.FindRuleWithOverride(c, importSpec, lang.Name()); ok {
+		set[override.Rel(from.Repo, from.Pkg).String()] = true
+	} else if jsConfig.Verbose {
+		log.Print(Info("[%s] skipping URL import %s", from.Abs(from.Repo, from.Pkg).String(), imp))
+	}
+	return true
+}
+
+// sourceFilePattern matches the extensions of js/ts source files, including
+// the explicit module formats of jsModuleExtensions
+var sourceFilePattern *regexp.Regexp
+
+func init() {
+	extensions := append(append([]string{}, tsExtensions...), jsExtensions...)
+	sourceFilePattern = extensionPattern(append(extensions, jsModuleExtensions...))
+}
+
+// isStylesheetImport reports whether filePath is a stylesheet imported by the
+// stylesheets of a web_assets rule, which depend on it rather than using it
+// as data.
+func isStylesheetImport(c *config.Config, r *rule.Rule, filePath string) bool {
+	return r != nil && r.Kind() == getKind(c, "web_assets") && isStylesheetFile(filePath)
+}
+
 // https://nodejs.org/api/modules.html#modules_all_together
 func (lang *JS) isNpmDependency(imp string, jsConfig *JsConfig) (bool, string, bool) {
+	lang.npmLookups[imp]++
 
 	// These prefixes cannot be NPM dependencies
 	var prefixes = []string{".", "/", "../", "~/", "@/", "~~/"}
@@ -399,21 +1841,25 @@ func (lang *JS) isNpmDependency(imp string, jsConfig *JsConfig) (bool, string, b
 		return false, "", false
 	}
 
-	// Grab the first part of the import (ie "foo/bar" -> "foo")
-	packageRoot := imp
-	for i := range imp {
-		if imp[i] == '/' {
-			prefix := imp[:i]
-			if prefix == "@types" {
-				continue
-			} else {
-				packageRoot = prefix
-				break
-			}
-		}
+	// Grab the package of the import (ie "foo/bar" -> "foo", "@scope/foo/bar" -> "@scope/foo")
+	packageRoot := npmPackageRoot(imp)
+
+	// Workspace packages are resolved from their sources
+	if jsConfig.WorkspacePackages[npmPackageRoot(imp)] {
+		return false, "", false
+	}
+
+	// Imports mapped to another repository are resolved to its labels
+	if _, ok := externalRepoLabel(imp, jsConfig); ok {
+		return false, "", false
+	}
+
+	// Is the package root found in package.json ? js_dep_precedence picks the
+	// section of packages listed in both
+	if npmLabel, ok := jsConfig.NpmDependencies.DevDependencies[packageRoot]; ok && jsConfig.DepPrecedence == "devdeps-wins" {
+		return true, npmLabel, true
 	}
 
-	// Is the package root found in package.json ?
 	if npmLabel, ok := jsConfig.NpmDependencies.Dependencies[packageRoot]; ok {
 		return true, npmLabel, false
 	}
@@ -434,6 +1880,41 @@ func (lang *JS) isNpmDependency(imp string, jsConfig *JsConfig) (bool, string, b
 	return false, "", false
 }
 
+// typesPackage returns the name of the package providing type declarations
+// for the runtime package name, defaulting to the @types/[...] convention.
+func typesPackage(name string, jsConfig *JsConfig) string {
+	if typesName, ok := jsConfig.TypesMapping[name]; ok {
+		return typesName
+	}
+	return "@types/" + name
+}
+
+// typesLookup maps the types packages needed by the imports of a rule to
+// whether only type-only imports need them.
+type typesLookup map[string]bool
+
+func (t typesLookup) add(typesName string, typeOnly bool) {
+	if prev, seen := t[typesName]; !seen || prev {
+		t[typesName] = typeOnly
+	}
+}
+
+// resolve looks up each types package once, adding the found ones to depSet,
+// or to typeDepSet when only type-only imports need them.
+func (t typesLookup) resolve(lookup func(typesName string) (string, bool), depSet, typeDepSet map[string]bool) {
+	for typesName, typeOnly := range t {
+		typesLabel, ok := lookup(typesName)
+		if !ok {
+			continue
+		}
+		if typeOnly && typeDepSet != nil {
+			typeDepSet[typesLabel] = true
+		} else {
+			depSet[typesLabel] = true
+		}
+	}
+}
+
 func hasPrefix(suffixes []string, x string) bool {
 	for _, suffix := range suffixes {
 		if strings.HasPrefix(x, suffix) {
@@ -443,6 +1924,143 @@ func hasPrefix(suffixes []string, x string) bool {
 	return false
 }
 
+// UnresolvedImportError is returned when no rule or file provides an import.
+type UnresolvedImportError struct {
+	Import string
+	From   label.Label
+	// Tries are the paths searched for the import
+	Tries []string
+	// Dir is the directory without a barrel the import names, if any
+	Dir string
+}
+
+func (e *UnresolvedImportError) Error() string {
+	if e.Dir != "" {
+		return fmt.Sprintf("[%s] import %v is the directory %s, which has no barrel file", e.From.Abs(e.From.Repo, e.From.Pkg).String(), e.Import, e.Dir)
+	}
+	return fmt.Sprintf("[%s] import %v not found", e.From.Abs(e.From.Repo, e.From.Pkg).String(), e.Import)
+}
+
+// MultipleMatchesError is returned when more than one rule provides an import.
+type MultipleMatchesError struct {
+	Import     string
+	From       label.Label
+	Candidates []label.Label
+}
+
+func newMultipleMatchesError(imp string, from label.Label, matches []resolve.FindResult) *MultipleMatchesError {
+	candidates := make([]label.Label, len(matches))
+	for i, match := range matches {
+		candidates[i] = match.Label
+	}
+	return &MultipleMatchesError{
+		Import:     imp,
+		From:       from,
+		Candidates: candidates,
+	}
+}
+
+func (e *MultipleMatchesError) Error() string {
+	return fmt.Sprintf("multiple rules (%s and %s) provide %s", e.Candidates[0], e.Candidates[1], e.Import)
+}
+
+// isUnresolved reports whether err is an *UnresolvedImportError
+func isUnresolved(err error) bool {
+	var unresolved *UnresolvedImportError
+	return errors.As(err, &unresolved)
+}
+
+// logResolveError reports a resolution error, honoring js_quiet and
+// js_verbose for unresolved imports.
+func logResolveError(err error, jsConfig *JsConfig) {
+	var unresolved *UnresolvedImportError
+	if !errors.As(err, &unresolved) {
+		log.Print(Err("%v", err))
+		return
+	}
+	// missing relative imports point at a broken source tree, while bare
+	// imports may be provided by the environment
+	relative := strings.HasPrefix(unresolved.Import, ".")
+	if !jsConfig.Quiet || (relative && !jsConfig.QuietRelative) {
+		log.Print(Err("%v", unresolved))
+	}
+	if jsConfig.Verbose {
+		log.Print(Warn("tried node_modules/%s", unresolved.Import))
+		for _, try := range unresolved.Tries {
+			log.Print(Warn("tried %s", try))
+		}
+	}
+}
+
+// normalizePath joins and cleans path elements into the repository path used
+// both to index and to look up files, so that srcs like "./a.ts" or
+// "lib/../a.ts" match the paths built from imports.
+func normalizePath(elem ...string) string {
+	p := path.Join(elem...)
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+// contextImport returns the import spec under which rules of context index
+// imp, for js_context_attr
+func contextImport(context string, imp string) string {
+	return "context:" + context + ":" + imp
+}
+
+// assetImport returns the import spec under which filegroups index filePath
+func assetImport(filePath string) string {
+	return "asset:" + normalizePath(filePath)
+}
+
+// macroRuleMatches strips the first matching js_rule_name_suffix from the
+// names of matches, dropping the matches that become duplicates, like foo_ts
+// when the my_ts_lib macro foo is indexed too.
+func macroRuleMatches(matches []resolve.FindResult, suffixes []string) []resolve.FindResult {
+	stripped := make([]resolve.FindResult, 0, len(matches))
+	seen := make(map[label.Label]bool)
+	for _, match := range matches {
+		for _, suffix := range suffixes {
+			if name := strings.TrimSuffix(match.Label.Name, suffix); name != match.Label.Name && name != "" {
+				match.Label.Name = name
+				break
+			}
+		}
+		if !seen[match.Label] {
+			seen[match.Label] = true
+			stripped = append(stripped, match)
+		}
+	}
+	return stripped
+}
+
+// collectAllImport returns the import spec under which collect-all rules
+// index the subfolders of their sources with js_collect_all_fallback
+func collectAllImport(dir string) string {
+	return "collect_all:" + normalizePath(dir)
+}
+
+// findAssetRule returns the filegroup providing the asset at filePath. When
+// several filegroups provide it, the first label in sorted order is used.
+func (lang *JS) findAssetRule(filePath string, c *config.Config, ix *resolve.RuleIndex, from label.Label) (label.Label, bool) {
+	importSpec := resolve.ImportSpec{
+		Lang: lang.Name(),
+		Imp:  assetImport(filePath),
+	}
+	matches := ix.FindRulesByImportWithConfig(c, importSpec, lang.Name())
+	if len(matches) == 0 {
+		return label.NoLabel, false
+	}
+	lbl := matches[0].Label
+	for _, match := range matches[1:] {
+		if match.Label.String() < lbl.String() {
+			lbl = match.Label
+		}
+	}
+	return lbl, true
+}
+
 type resolveResult struct {
 	label      label.Label
 	selfImport bool
@@ -476,27 +2094,90 @@ func (lang *JS) tryResolve(target string, c *config.Config, ix *resolve.RuleInde
 
 	matches := ix.FindRulesByImportWithConfig(c, importSpec, lang.Name())
 
+	// subfolders of collect-all rules resolve to them when no other rule provides them
+	if len(matches) == 0 && lang.collectAllFallbacks {
+		collectAllSpec := resolve.ImportSpec{
+			Lang: lang.Name(),
+			Imp:  collectAllImport(target),
+		}
+		matches = ix.FindRulesByImportWithConfig(c, collectAllSpec, lang.Name())
+	}
+
+	// rules generated by macros are named after the macro, like foo for foo_ts
+	if suffixes := c.Exts[languageName].(JsConfigs)[from.Pkg].RuleNameSuffixes; len(suffixes) > 0 {
+		matches = macroRuleMatches(matches, suffixes)
+	}
+
+	// files in several rules resolve to the rule of the importer's context
+	if context := c.Exts[languageName].(JsConfigs)[from.Pkg].Context; len(matches) > 1 && context != "" {
+		contextSpec := resolve.ImportSpec{
+			Lang: lang.Name(),
+			Imp:  contextImport(context, target),
+		}
+		if contextMatches := ix.FindRulesByImportWithConfig(c, contextSpec, lang.Name()); len(contextMatches) > 0 {
+			matches = contextMatches
+			if suffixes := c.Exts[languageName].(JsConfigs)[from.Pkg].RuleNameSuffixes; len(suffixes) > 0 {
+				matches = macroRuleMatches(matches, suffixes)
+			}
+		}
+	}
+
 	// too many matches
 	if len(matches) > 1 {
 		return resolveResult{
 			label:      label.NoLabel,
 			selfImport: false,
 			fileName:   "",
-			err:        fmt.Errorf("multiple rules (%s and %s) provide %s", matches[0].Label, matches[1].Label, target),
+			err:        newMultipleMatchesError(target, from, matches),
 		}
 	}
 
 	// no matches
 	if len(matches) == 0 {
 
+		jsConfigs := c.Exts[languageName].(JsConfigs)
+		jsConfig := jsConfigs[from.Pkg]
+
 		// no rule is found for this file
 		// it could be a regular file w/o a target
-		if fileInfo, err := os.Stat(path.Join(c.RepoRoot, target)); err == nil && !fileInfo.IsDir() {
+		exists, isDir := lang.dirs.stat(c.RepoRoot, target)
+
+		// does the case of the target match the file on disk?
+		if exists || jsConfig.CaseInsensitive {
+			if actual, ok := lang.dirs.matchFileCase(c.RepoRoot, target); ok && actual != target {
+				if !jsConfig.Quiet {
+					log.Print(Warn("[%s] import %s does not match the case of %s on disk", from.Abs(from.Repo, from.Pkg).String(), target, actual))
+				}
+				if jsConfig.CaseInsensitive {
+					return lang.tryResolve(actual, c, ix, from)
+				}
+			}
+		}
+
+		// is it generated from the source of another language, like foo_pb from foo.proto?
+		if lbl, ok := lang.generatingRule(target, c, ix, jsConfig); ok && !lbl.Equal(from) {
+			return resolveResult{
+				label:      lbl,
+				selfImport: false,
+				fileName:   "",
+				err:        nil,
+			}
+		}
+
+		// is it a path through a symlink into the sources of an indexed rule?
+		// Targets like ./a.ts only differ from their canonical path in spelling.
+		if exists {
+			if canonical, ok := lang.dirs.canonicalPath(c.RepoRoot, target); ok && canonical != normalizePath(target) {
+				return lang.tryResolve(canonical, c, ix, from)
+			}
+		}
+
+		if exists && !isDir {
 			// found a file matching the target
 			return resolveResult{
 				label:      label.NoLabel,
 				selfImport: false,
-				fileName:   fileInfo.Name(),
+				fileName:   path.Base(target),
 				err:        nil,
 			}
 
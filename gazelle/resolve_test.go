@@ -0,0 +1,2395 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+// Modifications copyright (C) 2021 BenchSci Analytics Inc.
+// Modifications copyright (C) 2018 Ecosia GmbH
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+// http://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package js
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/repo"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestImportsExcludeFromIndex(t *testing.T) {
+	lang := NewLanguage()
+	c := config.New()
+	lang.Configure(c, "", &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_exclude_from_index", Value: "**/*.gen.ts"},
+		},
+	})
+	f := &rule.File{
+		Pkg:  "lib",
+		Path: "lib/BUILD",
+		Directives: []rule.Directive{
+			{Key: "js_exclude_from_index", Value: "generated/**"},
+		},
+	}
+	lang.Configure(c, "lib", f)
+
+	r := rule.NewRule("ts_project", "lib")
+	r.SetAttr("srcs", []string{"a.ts", "a.gen.ts", "nested/b.gen.ts", "generated/c.ts"})
+
+	got := lang.Imports(c, r, f)
+	want := []resolve.ImportSpec{
+		{Lang: "js", Imp: "lib/a.ts"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+func TestImportsGenruleOuts(t *testing.T) {
+	lang := NewLanguage()
+	c := config.New()
+	lang.Configure(c, "", &rule.File{Pkg: ""})
+	f := &rule.File{
+		Pkg:  "api",
+		Path: "api/BUILD",
+		Directives: []rule.Directive{
+			{Key: "js_index_genrule_outs"},
+		},
+	}
+	lang.Configure(c, "api", f)
+
+	r := rule.NewRule("genrule", "client")
+	r.SetAttr("srcs", []string{":schema"})
+	r.SetAttr("outs", []string{"client.ts", "gen/types.d.ts"})
+
+	got := lang.Imports(c, r, f)
+	want := []resolve.ImportSpec{
+		{Lang: "js", Imp: "api/client.ts"},
+		{Lang: "js", Imp: "api/gen/types.d.ts"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+	if embeds := lang.Embeds(r, label.New("", "api", "client")); len(embeds) != 0 {
+		t.Errorf("expected genrules not to embed their srcs, got %v", embeds)
+	}
+
+	// genrules are not indexed by default
+	lang.Configure(c, "other", &rule.File{Pkg: "other", Path: "other/BUILD"})
+	if got := lang.Imports(c, r, &rule.File{Pkg: "other", Path: "other/BUILD"}); got != nil {
+		t.Errorf("expected no imports, got %#v", got)
+	}
+}
+
+func TestImportsCopyAssets(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	f := &rule.File{Pkg: "assets", Path: "assets/BUILD"}
+	lang.Configure(c, "assets", f)
+
+	fonts := rule.NewRule("copy_to_bin", "fonts")
+	fonts.SetAttr("srcs", []string{"inter.woff2", ":generated_font"})
+	logo := rule.NewRule("copy_file", "logo")
+	logo.SetAttr("src", "logo.src.svg")
+	logo.SetAttr("out", "logo.svg")
+
+	for _, tc := range []struct {
+		r    *rule.Rule
+		want []resolve.ImportSpec
+	}{
+		{r: fonts, want: []resolve.ImportSpec{{Lang: "js", Imp: "asset:assets/inter.woff2"}}},
+		{r: logo, want: []resolve.ImportSpec{{Lang: "js", Imp: "asset:assets/logo.svg"}}},
+	} {
+		if got := lang.Imports(c, tc.r, f); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Inequality.\ngot  %#v;\nwant %#v", tc.r.Name(), got, tc.want)
+		}
+		if embeds := lang.Embeds(tc.r, label.New("", "assets", tc.r.Name())); len(embeds) != 0 {
+			t.Errorf("%s: expected copies not to embed their srcs, got %v", tc.r.Name(), embeds)
+		}
+	}
+
+	// asset imports resolve to the copies, as data
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.AddRule(c, fonts, f)
+	ix.AddRule(c, logo, f)
+	ix.Finish()
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+	r := rule.NewRule("ts_project", "app")
+	r.SetAttr("srcs", []string{"app.ts"})
+	imps := &imports{set: map[string]bool{"../assets/inter.woff2": true, "../assets/logo.svg": true}}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "app"))
+
+	data := r.AttrStrings("data")
+	sort.Strings(data)
+	if want := []string{"//assets:fonts", "//assets:logo"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", data, want)
+	}
+	if len(r.AttrStrings("deps")) != 0 {
+		t.Errorf("expected no deps, got %#v", r.AttrStrings("deps"))
+	}
+}
+
+func TestImportsCollectAllKinds(t *testing.T) {
+	lang := NewLanguage()
+	c := config.New()
+	lang.Configure(c, "", &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_collect_all_kinds", Value: "ts_project, my_lib"},
+		},
+	})
+	f := &rule.File{
+		Pkg:  "lib",
+		Path: "lib/BUILD",
+		Directives: []rule.Directive{
+			{Key: "js_collect_all"},
+		},
+	}
+	lang.Configure(c, "lib", f)
+
+	imports := func(kind string) []string {
+		r := rule.NewRule(kind, "lib")
+		r.SetAttr("srcs", []string{"a.ts", "nested/b.ts"})
+		imps := make([]string, 0)
+		for _, spec := range lang.Imports(c, r, f) {
+			imps = append(imps, spec.Imp)
+		}
+		sort.Strings(imps)
+		return imps
+	}
+
+	folders := []string{"lib/.", "lib/a.ts", "lib/nested", "lib/nested/b.ts"}
+	files := []string{"lib/a.ts", "lib/nested/b.ts"}
+	for kind, want := range map[string][]string{
+		"my_lib":     folders,
+		"ts_project": folders,
+		"js_library": files,
+	} {
+		if got := imports(kind); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v; want %v", kind, got, want)
+		}
+	}
+}
+
+func TestImportsCollectAllBarrel(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"lib/index.ts", "lib/nested/index.ts", "lib/nested/b.ts", "lib/nested/b.test.ts"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{
+		Pkg:        "",
+		Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_collect_all_kinds", Value: "ts_project,jest_test"}},
+	})
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD", Directives: []rule.Directive{{Key: "js_collect_all"}}}
+	lang.Configure(c, "lib", f)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	lib := rule.NewRule("ts_project", "lib")
+	lib.SetAttr("srcs", []string{"index.ts", "nested/index.ts", "nested/b.ts"})
+	ix.AddRule(c, lib, f)
+
+	// the tests of nested do not provide it, as its barrel is in lib
+	test := rule.NewRule("jest_test", "lib_test")
+	test.SetAttr("srcs", []string{"nested/b.test.ts"})
+	imps := make([]string, 0)
+	for _, spec := range lang.Imports(c, test, f) {
+		imps = append(imps, spec.Imp)
+	}
+	if want := []string{"lib/nested/b.test.ts"}; !reflect.DeepEqual(imps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imps, want)
+	}
+	ix.AddRule(c, test, f)
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"./lib/nested": true}}, label.New("", "", "main"))
+	if deps, want := r.AttrStrings("deps"), []string{"//lib"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+}
+
+func TestImportsFilesystemIndex(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.ts", "b.tsx", "c.js", "c.test.ts", "other.ts", "README.md"} {
+		if err := os.WriteFile(filepath.Join(repoRoot, "lib", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		directive string
+		want      []string
+	}{
+		{name: "disabled", directive: "false", want: []string{}},
+		{name: "enabled", directive: "true", want: []string{"lib/a.ts", "lib/b.tsx", "lib/c.js"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lang := NewLanguage()
+			c := newResolveConfig(t, repoRoot)
+			lang.Configure(c, "", &rule.File{
+				Pkg:        "",
+				Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_filesystem_index", Value: tc.directive}},
+			})
+
+			// srcs = MY_SRCS, loaded from a .bzl file
+			lib := rule.NewRule("ts_project", "lib")
+			lib.SetAttr("srcs", &bzl.Ident{Name: "MY_SRCS"})
+			other := rule.NewRule("ts_project", "other")
+			other.SetAttr("srcs", []string{"other.ts"})
+			f := &rule.File{Pkg: "lib", Path: "lib/BUILD", Rules: []*rule.Rule{lib, other}}
+			lang.Configure(c, "lib", f)
+
+			imps := make([]string, 0)
+			for _, spec := range lang.Imports(c, lib, f) {
+				imps = append(imps, spec.Imp)
+			}
+			if !reflect.DeepEqual(imps, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", imps, tc.want)
+			}
+		})
+	}
+
+	// the sources of literal and glob srcs are known, even when empty
+	for _, expr := range []bzl.Expr{
+		&bzl.ListExpr{},
+		&bzl.CallExpr{X: &bzl.Ident{Name: "glob"}, List: []bzl.Expr{&bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "*.vue"}}}}},
+	} {
+		if unevaluatedSrcs(expr) {
+			t.Errorf("unevaluatedSrcs(%#v) = true", expr)
+		}
+	}
+	if !unevaluatedSrcs(&bzl.CallExpr{X: &bzl.Ident{Name: "ts_srcs"}}) {
+		t.Errorf("unevaluatedSrcs(ts_srcs()) = false")
+	}
+}
+
+func TestResolveCollectAllFallback(t *testing.T) {
+	for _, tc := range []struct {
+		fallback string
+		nested   []string
+		ok       bool
+	}{
+		{fallback: "false", ok: false},
+		{fallback: "true", nested: []string{"//lib/nested"}, ok: true},
+	} {
+		t.Run(tc.fallback, func(t *testing.T) {
+			lang := NewLanguage().(*JS)
+			c := newResolveConfig(t, t.TempDir())
+			lang.Configure(c, "", &rule.File{
+				Pkg:        "",
+				Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_collect_all_fallback", Value: tc.fallback}},
+			})
+			f := &rule.File{Pkg: "lib", Path: "lib/BUILD", Directives: []rule.Directive{{Key: "js_collect_all"}}}
+			lang.Configure(c, "lib", f)
+			nestedFile := &rule.File{Pkg: "lib/nested", Path: "lib/nested/BUILD"}
+			lang.Configure(c, "lib/nested", nestedFile)
+
+			// the aggregate still owns the sources being split into lib/nested
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			aggregate := rule.NewRule("ts_project", "lib")
+			aggregate.SetAttr("srcs", []string{"index.ts", "nested/index.ts", "other/c.ts"})
+			ix.AddRule(c, aggregate, f)
+			nested := rule.NewRule("ts_project", "nested")
+			nested.SetAttr("srcs", []string{"index.ts"})
+			ix.AddRule(c, nested, nestedFile)
+			ix.Finish()
+
+			// collect-all imports are only looked up when they were indexed
+			if got, want := lang.collectAllFallbacks, tc.fallback == "true"; got != want {
+				t.Errorf("collectAllFallbacks = %v, want %v", got, want)
+			}
+
+			from := label.New("", "", "main")
+			result := lang.tryResolve("lib/nested", c, ix, from)
+			if ok := result.err == nil; ok != tc.ok {
+				t.Fatalf("tryResolve(lib/nested) error = %v", result.err)
+			}
+			if tc.ok && result.label.String() != "//lib/nested" {
+				t.Errorf("tryResolve(lib/nested) = %s, want //lib/nested", result.label)
+			}
+			if result := lang.tryResolve("lib/other", c, ix, from); result.err != nil || result.label.String() != "//lib" {
+				t.Errorf("tryResolve(lib/other) = %s, %v; want //lib", result.label, result.err)
+			}
+
+			r := rule.NewRule("ts_project", "main")
+			r.SetAttr("srcs", []string{"main.ts"})
+			lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"./lib/nested": true}}, from)
+			if deps := r.AttrStrings("deps"); !reflect.DeepEqual(deps, tc.nested) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, tc.nested)
+			}
+		})
+	}
+}
+
+func TestMatchFileCase(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "lib", "Components"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"lib/Components/button.ts"} {
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		desc, target, want string
+		found              bool
+	}{
+		{
+			desc:   "exact",
+			target: "lib/Components/button.ts",
+			want:   "lib/Components/button.ts",
+			found:  true,
+		},
+		{
+			desc:   "mismatched file",
+			target: "lib/Components/Button.ts",
+			want:   "lib/Components/button.ts",
+			found:  true,
+		},
+		{
+			desc:   "mismatched directory",
+			target: "lib/components/button.ts",
+			want:   "lib/Components/button.ts",
+			found:  true,
+		},
+		{
+			desc:   "missing",
+			target: "lib/missing.ts",
+			want:   "",
+			found:  false,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, found := newDirCache().matchFileCase(repoRoot, tc.target)
+			if got != tc.want || found != tc.found {
+				t.Errorf("matchFileCase(%q) = %q, %v; want %q, %v", tc.target, got, found, tc.want, tc.found)
+			}
+		})
+	}
+}
+
+func TestEmbeds(t *testing.T) {
+	lang := NewLanguage()
+	from := label.New("", "lib", "lib")
+
+	wrapper := rule.NewRule("js_library", "lib")
+	wrapper.SetAttr("srcs", []string{":lib_ts", "//other:other", "index.js"})
+
+	got := lang.Embeds(wrapper, from)
+	want := []label.Label{
+		label.New("", "lib", "lib_ts"),
+		label.New("", "other", "other"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+
+	// only source files are indexed for the wrapper
+	c := config.New()
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", nil)
+	lang.Configure(c, "lib", f)
+	gotImports := lang.Imports(c, wrapper, f)
+	wantImports := []resolve.ImportSpec{
+		{Lang: "js", Imp: "lib/index.js"},
+		{Lang: "js", Imp: "lib"},
+	}
+	if !reflect.DeepEqual(gotImports, wantImports) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", gotImports, wantImports)
+	}
+
+	assets := rule.NewRule("web_assets", "all_assets")
+	assets.SetAttr("srcs", []string{"//:data_json"})
+	if embeds := lang.Embeds(assets, label.New("", "", "all_assets")); len(embeds) != 0 {
+		t.Errorf("expected web_assets not to embed rules, got %v", embeds)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	from := label.New("", "lib", "lib")
+	set := map[string]bool{
+		":a":                       true,
+		"//lib:a":                  true,
+		"//lib/nested:b":           true,
+		"//:node_modules/react":    true,
+		"@npm//:node_modules/left": true,
+	}
+
+	for _, tc := range []struct {
+		style string
+		want  []string
+	}{
+		{
+			style: "",
+			want:  []string{"//:node_modules/react", "//lib/nested:b", "//lib:a", ":a", "@npm//:node_modules/left"},
+		},
+		{
+			style: "absolute",
+			want:  []string{"//:node_modules/react", "//lib/nested:b", "//lib:a", "@npm//:node_modules/left"},
+		},
+		{
+			style: "relative",
+			want:  []string{"//:node_modules/react", "//lib/nested:b", ":a", "@npm//:node_modules/left"},
+		},
+	} {
+		t.Run(tc.style, func(t *testing.T) {
+			got := formatLabels(set, tc.style, from)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelfReference(t *testing.T) {
+	jsConfig := NewJsConfig()
+	jsConfig.PackageName = "@acme/lib"
+	jsConfig.PackageDir = "packages/lib"
+	jsConfig.PackageExportsRaw = []byte(`{
+		".": {"types": "./src/index.ts", "default": "./dist/index.js"},
+		"./utils/*": "./src/utils/*.ts",
+		"./utils/internal/*": null,
+		"./config": {"import": {"types": "./src/config.ts"}}
+	}`)
+	jsConfig.PackageExports = readPackageExports(jsConfig.PackageExportsRaw, nil)
+
+	for _, tc := range []struct {
+		imp, want string
+		ok        bool
+	}{
+		{imp: "@acme/lib", want: "packages/lib/src/index.ts", ok: true},
+		{imp: "@acme/lib/utils/format", want: "packages/lib/src/utils/format.ts", ok: true},
+		{imp: "@acme/lib/config", want: "packages/lib/src/config.ts", ok: true},
+		// subpaths missing from the exports, or blocked, can't be imported
+		{imp: "@acme/lib/src/other", want: "", ok: false},
+		{imp: "@acme/lib/utils/internal/cache", want: "", ok: false},
+		{imp: "@acme/library", want: "", ok: false},
+		{imp: "lodash", want: "", ok: false},
+	} {
+		t.Run(tc.imp, func(t *testing.T) {
+			got, ok := selfReference(tc.imp, jsConfig, nil)
+			if got != tc.want || ok != tc.ok {
+				t.Errorf("selfReference(%q) = %q, %v; want %q, %v", tc.imp, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+
+	// without exports, subpaths are files of the package
+	noExports := NewJsConfig()
+	noExports.PackageName = "@acme/lib"
+	noExports.PackageDir = "packages/lib"
+	noExports.PackageExports["."] = "./src/main.ts"
+	for imp, want := range map[string]string{"@acme/lib": "packages/lib/src/main.ts", "@acme/lib/src/other": "packages/lib/src/other"} {
+		if got, ok := selfReference(imp, noExports, nil); got != want || !ok {
+			t.Errorf("selfReference(%q) = %q, %v; want %q, true", imp, got, ok, want)
+		}
+	}
+
+	if got := relativeImport("app", "packages/lib/src/index.ts"); got != "../packages/lib/src/index.ts" {
+		t.Errorf("relativeImport() = %q", got)
+	}
+	if got := relativeImport("packages/lib", "packages/lib/src/index.ts"); got != "./src/index.ts" {
+		t.Errorf("relativeImport() = %q", got)
+	}
+}
+
+func TestSelfReferenceConditions(t *testing.T) {
+	jsConfig := NewJsConfig()
+	jsConfig.PackageName = "@myorg/ui"
+	jsConfig.PackageDir = "packages/ui"
+	jsConfig.PackageExportsRaw = []byte(`{
+		".": {"node": "./src/node.ts", "browser": "./src/browser.ts", "default": "./src/node.ts"},
+		"./theme": {"development": "./src/theme_dev.ts", "production": "./src/theme.ts"}
+	}`)
+	jsConfig.PackageExports = readPackageExports(jsConfig.PackageExportsRaw, nil)
+
+	for _, tc := range []struct {
+		imp        string
+		conditions []string
+		want       string
+	}{
+		{imp: "@myorg/ui", want: "packages/ui/src/node.ts"},
+		{imp: "@myorg/ui", conditions: []string{"browser", "production"}, want: "packages/ui/src/browser.ts"},
+		{imp: "@myorg/ui/theme", conditions: []string{"browser", "production"}, want: "packages/ui/src/theme.ts"},
+		{imp: "@myorg/ui/theme", conditions: []string{"node", "development"}, want: "packages/ui/src/theme_dev.ts"},
+	} {
+		if got, _ := selfReference(tc.imp, jsConfig, tc.conditions); got != tc.want {
+			t.Errorf("selfReference(%q, %v) = %q, want %q", tc.imp, tc.conditions, got, tc.want)
+		}
+	}
+}
+
+func TestSubpathImport(t *testing.T) {
+	jsConfig := NewJsConfig()
+	jsConfig.PackageDir = "packages/app"
+	jsConfig.PackageImportsRaw = []byte(`{
+		"#env": {"node": "./src/env.node.ts", "default": "./src/env.ts"},
+		"#internal/*": "./src/internal/*.ts",
+		"#dep": {"browser": "lodash-es", "default": "lodash"}
+	}`)
+
+	for _, tc := range []struct {
+		imp        string
+		conditions []string
+		want       string
+		ok         bool
+	}{
+		{imp: "#env", want: "./src/env.ts", ok: true},
+		{imp: "#env", conditions: []string{"node"}, want: "./src/env.node.ts", ok: true},
+		{imp: "#env", conditions: []string{"browser"}, want: "./src/env.ts", ok: true},
+		{imp: "#internal/format", want: "./src/internal/format.ts", ok: true},
+		{imp: "#dep", conditions: []string{"browser"}, want: "lodash-es", ok: true},
+		{imp: "#missing", want: "", ok: false},
+	} {
+		if got, ok := subpathImport(tc.imp, jsConfig, tc.conditions); got != tc.want || ok != tc.ok {
+			t.Errorf("subpathImport(%q, %v) = %q, %v; want %q, %v", tc.imp, tc.conditions, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestAmbientModulePattern(t *testing.T) {
+	pattern := ambientModulePattern([]string{"*.svg", "untyped-pkg", "virtual:*"})
+	for imp, want := range map[string]bool{
+		"./logo.svg":        true,
+		"../icons/logo.svg": true,
+		"untyped-pkg":       true,
+		"untyped-pkg/sub":   false,
+		"virtual:routes":    true,
+		"./logo.svg.ts":     false,
+		"lodash":            false,
+	} {
+		if got := pattern.MatchString(imp); got != want {
+			t.Errorf("MatchString(%q) = %v, want %v", imp, got, want)
+		}
+	}
+	if ambientModulePattern(nil).MatchString("lodash") {
+		t.Errorf("expected empty pattern not to match")
+	}
+}
+
+// newResolveConfig returns a config set up for resolving imports in repoRoot
+func newResolveConfig(t *testing.T, repoRoot string) *config.Config {
+	c := config.New()
+	c.RepoRoot = repoRoot
+	rc := &resolve.Configurer{}
+	rc.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError), "update", c)
+	if err := rc.CheckFlags(flag.NewFlagSet("test", flag.ContinueOnError), c); err != nil {
+		t.Fatal(err)
+	}
+	rc.Configure(c, "", nil)
+	return c
+}
+
+func TestResolveErrors(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	lang.Configure(c, "lib", f)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, name := range []string{"a", "b"} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{"util.ts"})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	from := label.New("", "lib", "c")
+	err := lang.resolveWalkParents("./util", map[string]bool{}, map[string]bool{}, c, ix, nil, nil, from)
+	var multiple *MultipleMatchesError
+	if !errors.As(err, &multiple) {
+		t.Fatalf("expected a MultipleMatchesError, got %v", err)
+	}
+	wantCandidates := []label.Label{label.New("", "lib", "a"), label.New("", "lib", "b")}
+	if multiple.Import != "lib/util.ts" || multiple.From != from || !reflect.DeepEqual(multiple.Candidates, wantCandidates) {
+		t.Errorf("unexpected error fields %#v", multiple)
+	}
+	if isUnresolved(err) {
+		t.Errorf("expected %v not to be unresolved", err)
+	}
+
+	err = lang.resolveWalkParents("./missing", map[string]bool{}, map[string]bool{}, c, ix, nil, nil, from)
+	var unresolved *UnresolvedImportError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected an UnresolvedImportError, got %v", err)
+	}
+	if unresolved.Import != "./missing" || unresolved.From != from || len(unresolved.Tries) == 0 {
+		t.Errorf("unexpected error fields %#v", unresolved)
+	}
+	if got, want := err.Error(), "[//lib:c] import ./missing not found"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestResolveNormalizedSrcs(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	lang.Configure(c, "lib", f)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for name, src := range map[string]string{
+		"a":     "./a.ts",
+		"b":     "sub/../b.ts",
+		"c":     "sub//c.ts",
+		"utils": "utils/index.ts",
+		"view":  "view.tsx",
+		"esm":   "esm.mjs",
+	} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{src})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	from := label.New("", "lib", "d")
+	for _, tc := range []struct {
+		imp   string
+		want  string
+		tries []string
+	}{
+		{imp: "./a", want: ":a"},
+		{imp: "../lib/./b", want: ":b"},
+		{imp: "./sub/c", want: ":c"},
+		{imp: "./sub/../b", want: ":b"},
+		{imp: "./sub/./c.ts", want: ":c"},
+		// imports naming a source file are tried as-is
+		{imp: "./utils/index.ts", want: ":utils"},
+		{imp: "./view.tsx", want: ":view"},
+		{imp: "./esm.mjs", want: ":esm"},
+		// in each directory
+		{imp: "./missing.ts", tries: []string{"lib/missing.ts", "missing.ts"}},
+	} {
+		depSet := map[string]bool{}
+		err := lang.resolveWalkParents(tc.imp, depSet, map[string]bool{}, c, ix, nil, nil, from)
+		if tc.tries != nil {
+			var unresolved *UnresolvedImportError
+			if !errors.As(err, &unresolved) {
+				t.Errorf("resolving %s: expected an UnresolvedImportError, got %v", tc.imp, err)
+			} else if !reflect.DeepEqual(unresolved.Tries, tc.tries) {
+				t.Errorf("resolving %s: got tries %#v, want %#v", tc.imp, unresolved.Tries, tc.tries)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolving %s: %v", tc.imp, err)
+		}
+		if !reflect.DeepEqual(depSet, map[string]bool{tc.want: true}) {
+			t.Errorf("resolving %s: got %v, want %s", tc.imp, depSet, tc.want)
+		}
+	}
+}
+
+func TestBundleLabels(t *testing.T) {
+	bundle := label.New("", "widgets", "bundle")
+	jsConfigs := JsConfigs{"": NewJsConfig(), "widgets": NewJsConfig(), "widgets/icons": NewJsConfig()}
+	jsConfigs["widgets"].Bundle = bundle
+	jsConfigs["widgets/icons"].Bundle = bundle
+
+	set := map[string]bool{"//widgets:button": true, "//widgets/icons:icon": true, ":util": true, "//:node_modules/react": true}
+
+	// into the bundle
+	got := bundleLabels(set, jsConfigs, label.NoLabel, label.New("", "", "app"))
+	want := map[string]bool{"//widgets:bundle": true, ":util": true, "//:node_modules/react": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+
+	// inside the bundle
+	got = bundleLabels(set, jsConfigs, bundle, label.New("", "widgets", "button"))
+	if !reflect.DeepEqual(got, set) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, set)
+	}
+}
+
+func TestNpmPackageName(t *testing.T) {
+	jsConfig := NewJsConfig()
+	for name, version := range map[string]string{
+		"my-react":  "npm:react@^18.2.0",
+		"my-utils":  "npm:@scope/utils@1.0.0",
+		"latest":    "npm:left-pad",
+		"lodash":    "^4.17",
+		"not-alias": "github:user/repo",
+	} {
+		if pkg, ok := npmAlias(version); ok {
+			jsConfig.NpmAliases[name] = pkg
+		}
+	}
+
+	for imp, want := range map[string]string{
+		"my-react":             "react",
+		"my-react/jsx-runtime": "react",
+		"my-utils/format":      "@scope/utils",
+		"latest":               "left-pad",
+		"lodash/get":           "lodash",
+		"not-alias":            "not-alias",
+	} {
+		if got := npmPackageName(imp, jsConfig); got != want {
+			t.Errorf("npmPackageName(%q) = %q, want %q", imp, got, want)
+		}
+	}
+}
+
+func TestCollapseNpmSubpaths(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	jsConfig := NewJsConfig()
+	jsConfig.NpmDependencies.Dependencies["lodash"] = "@npm//:"
+	jsConfig.NpmDependencies.DevDependencies["@scope/ui"] = "@npm//:"
+	jsConfig.WebAssetSuffixes[".css"] = true
+
+	names := map[string]bool{
+		"lodash/map":        true,
+		"lodash/filter":     true,
+		"lodash/reduce":     true,
+		"lodash/styles.css": true,
+		"@scope/ui/button":  true,
+		"@scope/ui/types":   true,
+		"@other/pkg/sub":    true,
+		"./local/util":      true,
+	}
+	types := map[string]bool{
+		"lodash/map":      true,
+		"@scope/ui/types": true,
+	}
+	collapsed, collapsedTypes := lang.collapseNpmSubpaths(names, types, jsConfig)
+
+	// subpaths are collapsed without looking up npm dependencies
+	if len(lang.npmLookups) != 0 {
+		t.Errorf("expected no npm lookups, got %#v", lang.npmLookups)
+	}
+	want := map[string]bool{
+		"lodash":            true,
+		"lodash/styles.css": true,
+		"@scope/ui":         true,
+		"@other/pkg/sub":    true,
+		"./local/util":      true,
+	}
+	if !reflect.DeepEqual(collapsed, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", collapsed, want)
+	}
+	// lodash and @scope/ui are also imported as values
+	if len(collapsedTypes) != 0 {
+		t.Errorf("expected no type-only imports, got %#v", collapsedTypes)
+	}
+}
+
+func TestNpmPackageLabel(t *testing.T) {
+	jsConfig := NewJsConfig()
+	for _, tc := range []struct {
+		suffix, npmLabel, pkg, want string
+	}{
+		{"{name}", "//:node_modules/", "react", "//:node_modules/react"},
+		{"{name}", "@npm//", "@scope/ui", "@npm//@scope/ui"},
+		{"{name}:{name}", "@npm//", "react", "@npm//react:react"},
+		{"{name}:{name}", "@npm//", "@scope/ui", "@npm//@scope/ui:ui"},
+		{"{name}:pkg", "@npm//", "@scope/ui", "@npm//@scope/ui:pkg"},
+	} {
+		jsConfig.NpmLabelSuffix = tc.suffix
+		if got := npmPackageLabel(tc.npmLabel, tc.pkg, jsConfig); got != tc.want {
+			t.Errorf("npmPackageLabel(%q, %q) with suffix %q = %q, want %q", tc.npmLabel, tc.pkg, tc.suffix, got, tc.want)
+		}
+	}
+}
+
+func TestResolveRelativeImport(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	root := &rule.File{Pkg: "", Path: "BUILD"}
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	lang.Configure(c, "lib", f)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, file := range []*rule.File{root, f} {
+		r := rule.NewRule("ts_project", "util")
+		r.SetAttr("srcs", []string{"util.ts"})
+		ix.AddRule(c, r, file)
+	}
+	ix.Finish()
+
+	// "./util.ts" is relative to lib, not to the repository root
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := imports{
+		set:   map[string]bool{"./util.ts": true},
+		types: map[string]bool{},
+		data:  map[string]bool{},
+	}
+	lang.Resolve(c, ix, nil, r, &imps, label.New("", "lib", "main"))
+	if got, want := r.AttrStrings("deps"), []string{":util"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got deps %v, want %v", got, want)
+	}
+}
+
+func TestImportsGlobSrcs(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{
+		"lib/a.ts",
+		"lib/b.tsx",
+		"lib/a.test.ts",
+		"lib/nested/c.ts",
+		"lib/nested/styles.css",
+		"lib/sub/BUILD.bazel",
+		"lib/sub/d.ts",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lang := NewLanguage()
+	c := config.New()
+	c.RepoRoot = repoRoot
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "", nil)
+	lang.Configure(c, "lib", f)
+
+	r := rule.NewRule("ts_project", "lib")
+	// srcs = ["extra.ts"] + glob(["**/*.ts", "**/*.tsx"], exclude = ["**/*.test.ts"])
+	r.SetAttr("srcs", &bzl.BinaryExpr{
+		X:  &bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "extra.ts"}}},
+		Op: "+",
+		Y: &bzl.CallExpr{
+			X: &bzl.Ident{Name: "glob"},
+			List: []bzl.Expr{
+				&bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "**/*.ts"}, &bzl.StringExpr{Value: "**/*.tsx"}}},
+				&bzl.AssignExpr{
+					LHS: &bzl.Ident{Name: "exclude"},
+					Op:  "=",
+					RHS: &bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "**/*.test.ts"}}},
+				},
+			},
+		},
+	})
+
+	got := lang.Imports(c, r, f)
+	want := []resolve.ImportSpec{
+		{Lang: "js", Imp: "lib/extra.ts"},
+		{Lang: "js", Imp: "lib/a.ts"},
+		{Lang: "js", Imp: "lib/b.tsx"},
+		{Lang: "js", Imp: "lib/nested/c.ts"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+
+	// the glob is only expanded once, like from Resolve
+	reads := lang.(*JS).dirs.reads
+	if got := lang.Imports(c, r, f); !reflect.DeepEqual(got, want) || lang.(*JS).dirs.reads != reads {
+		t.Errorf("expected the same imports without reading directories, got %#v after %d reads", got, lang.(*JS).dirs.reads-reads)
+	}
+
+	// unsupported expressions index nothing
+	r.SetAttr("srcs", &bzl.CallExpr{X: &bzl.Ident{Name: "select"}})
+	if got := lang.Imports(c, r, f); len(got) != 0 {
+		t.Errorf("expected no imports, got %#v", got)
+	}
+}
+
+func TestResolveAggregatorKinds(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "js_aggregator_kinds", Value: "js_library"},
+		},
+	})
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	aggregator := rule.NewRule("js_library", "all")
+	aggregator.SetAttr("deps", []string{"//a", "//b"})
+	lang.Resolve(c, ix, nil, aggregator, &noImports, label.New("", "", "all"))
+	if got, want := aggregator.AttrStrings("deps"), []string{"//a", "//b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected aggregator deps to be kept, got %v", got)
+	}
+
+	// rules with sources are still resolved
+	library := rule.NewRule("js_library", "lib")
+	library.SetAttr("srcs", []string{"lib.js"})
+	library.SetAttr("deps", []string{"//a"})
+	lang.Resolve(c, ix, nil, library, &noImports, label.New("", "", "lib"))
+	if got := library.AttrStrings("deps"); len(got) != 0 {
+		t.Errorf("expected deps to be resolved, got %v", got)
+	}
+}
+
+func TestResolveTypeDeps(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	f := &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "js_type_deps_attr", Value: "type_deps"},
+		},
+	}
+	lang.Configure(c, "", f)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, name := range []string{"lib", "model", "both"} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{name + ".ts"})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	app := rule.NewRule("ts_project", "app")
+	app.SetAttr("srcs", []string{"app.ts"})
+	imps := &imports{
+		set:   map[string]bool{"./lib": true, "./model": true, "./both": true},
+		types: map[string]bool{"./model": true},
+	}
+	lang.Resolve(c, ix, nil, app, imps, label.New("", "", "app"))
+
+	deps := app.AttrStrings("deps")
+	sort.Strings(deps)
+	if want := []string{":both", ":lib"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+	if got, want := app.AttrStrings("type_deps"), []string{":model"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+func TestTypeDepsAttrKinds(t *testing.T) {
+	lang := NewLanguage()
+	kinds := lang.Kinds()
+	if kinds["ts_project"].ResolveAttrs["compile_deps"] {
+		t.Fatal("expected compile_deps not to be resolved before it is configured")
+	}
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_type_deps_attr", Value: "compile_deps"}}})
+
+	// the kinds returned before configuring are updated, like gazelle's copy
+	if !kinds["ts_project"].ResolveAttrs["compile_deps"] {
+		t.Errorf("expected compile_deps to be marked as resolved, got %v", kinds["ts_project"].ResolveAttrs)
+	}
+}
+
+func TestResolveDevDepRuntimeKinds(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "js_devdep_runtime_kinds", Value: "jest_test, my_tool"},
+		},
+	})
+	jsConfig := c.Exts[languageName].(JsConfigs)[""]
+	jsConfig.NpmDependencies.Dependencies["lodash"] = "//:node_modules/"
+	jsConfig.NpmDependencies.DevDependencies["esbuild"] = "//:node_modules/"
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	for kind, want := range map[string][]string{
+		"my_tool":    {"//:node_modules/esbuild", "//:node_modules/lodash"},
+		"ts_project": {"//:node_modules/lodash"},
+	} {
+		r := rule.NewRule(kind, "build")
+		r.SetAttr("srcs", []string{"build.ts"})
+		imps := &imports{set: map[string]bool{"esbuild": true, "lodash": true}}
+		lang.Resolve(c, ix, nil, r, imps, label.New("", "", "build"))
+
+		deps := r.AttrStrings("deps")
+		sort.Strings(deps)
+		if want := []string{"//:node_modules/esbuild", "//:node_modules/lodash"}; !reflect.DeepEqual(deps, want) {
+			t.Errorf("%s deps: Inequality.\ngot  %#v;\nwant %#v", kind, deps, want)
+		}
+		data := r.AttrStrings("data")
+		sort.Strings(data)
+		if !reflect.DeepEqual(data, want) {
+			t.Errorf("%s data: Inequality.\ngot  %#v;\nwant %#v", kind, data, want)
+		}
+	}
+}
+
+func TestResolveDepPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		precedence string
+		wantData   []string
+	}{
+		{precedence: "", wantData: []string{"//:node_modules/react"}},
+		{precedence: "deps-wins", wantData: []string{"//:node_modules/react"}},
+		{precedence: "devdeps-wins"},
+	} {
+		t.Run(tc.precedence, func(t *testing.T) {
+			lang := NewLanguage()
+			c := newResolveConfig(t, t.TempDir())
+			directives := []rule.Directive{{Key: "js_root"}}
+			if tc.precedence != "" {
+				directives = append(directives, rule.Directive{Key: "js_dep_precedence", Value: tc.precedence})
+			}
+			lang.Configure(c, "", &rule.File{Pkg: "", Directives: directives})
+			jsConfig := c.Exts[languageName].(JsConfigs)[""]
+			jsConfig.NpmDependencies.Dependencies["react"] = "//:node_modules/"
+			jsConfig.NpmDependencies.DevDependencies["react"] = "//:node_modules/"
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			ix.Finish()
+
+			r := rule.NewRule("ts_project", "app")
+			r.SetAttr("srcs", []string{"app.ts"})
+			imps := &imports{set: map[string]bool{"react": true}}
+			lang.Resolve(c, ix, nil, r, imps, label.New("", "", "app"))
+
+			if want := []string{"//:node_modules/react"}; !reflect.DeepEqual(r.AttrStrings("deps"), want) {
+				t.Errorf("deps: Inequality.\ngot  %#v;\nwant %#v", r.AttrStrings("deps"), want)
+			}
+			if !reflect.DeepEqual(r.AttrStrings("data"), tc.wantData) {
+				t.Errorf("data: Inequality.\ngot  %#v;\nwant %#v", r.AttrStrings("data"), tc.wantData)
+			}
+		})
+	}
+}
+
+func TestResolveDataOverride(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	f := &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "resolve", Value: "js codegen //tools:codegen"},
+			{Key: "resolve", Value: "js tools/format.sh //tools:format"},
+		},
+	}
+	(&resolve.Configurer{}).Configure(c, "", f)
+	lang.Configure(c, "", f)
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "build")
+	r.SetAttr("srcs", []string{"build.ts"})
+	imps := &imports{
+		set:  map[string]bool{},
+		data: map[string]bool{"codegen": true, "./tools/format.sh": true},
+	}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "", "build"))
+
+	data := r.AttrStrings("data")
+	sort.Strings(data)
+	if want := []string{"//tools:codegen", "//tools:format"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", data, want)
+	}
+	if deps := r.AttrStrings("deps"); len(deps) != 0 {
+		t.Errorf("expected no deps, got %#v", deps)
+	}
+}
+
+func TestResolveURLImports(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	f := &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "resolve", Value: "js https://esm.sh/react@18 //:node_modules/react"},
+		},
+	}
+	(&resolve.Configurer{}).Configure(c, "", f)
+	lang.Configure(c, "", f)
+	lang.Configure(c, "web", &rule.File{Pkg: "web"})
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "app")
+	r.SetAttr("srcs", []string{"app.ts"})
+	imps := &imports{
+		set: map[string]bool{
+			"https://esm.sh/lodash":                 true,
+			"http://localhost:8080/dev.js":          true,
+			"data:text/javascript,export default 1": true,
+			"blob:https://example.com/1234":         true,
+			"https://esm.sh/react@18":               true,
+		},
+		data: map[string]bool{"https://example.com/font.woff2": true},
+	}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "web", "app"))
+
+	if deps, want := r.AttrStrings("deps"), []string{"//:node_modules/react"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+	if data := r.AttrStrings("data"); len(data) != 0 {
+		t.Errorf("expected no data, got %#v", data)
+	}
+	if logs := buf.String(); logs != "" {
+		t.Errorf("expected URL imports to be skipped silently, got %q", logs)
+	}
+}
+
+func TestResolveExtensionPriority(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo.ts", "foo.js"} {
+		if err := os.WriteFile(filepath.Join(repoRoot, "lib", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		priority       string
+		wantTS, wantJS string
+	}{
+		{priority: "", wantTS: ":foo_ts", wantJS: ":foo_js"},
+		{priority: "ts,js", wantTS: ":foo_ts", wantJS: ":foo_ts"},
+		{priority: "js", wantTS: ":foo_js", wantJS: ":foo_js"},
+	} {
+		t.Run(tc.priority, func(t *testing.T) {
+			var buf bytes.Buffer
+			log.SetOutput(&buf)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			lang := NewLanguage()
+			c := newResolveConfig(t, repoRoot)
+			directives := []rule.Directive{{Key: "js_root"}, {Key: "js_verbose"}}
+			if tc.priority != "" {
+				directives = append(directives, rule.Directive{Key: "js_extension_priority", Value: tc.priority})
+			}
+			lang.Configure(c, "", &rule.File{Pkg: "", Directives: directives})
+			f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+			lang.Configure(c, "lib", f)
+
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			for name, src := range map[string]string{"foo_ts": "foo.ts", "foo_js": "foo.js"} {
+				r := rule.NewRule("ts_project", name)
+				r.SetAttr("srcs", []string{src})
+				ix.AddRule(c, r, f)
+			}
+			ix.Finish()
+
+			for kind, want := range map[string]string{"ts_project": tc.wantTS, "js_library": tc.wantJS} {
+				r := rule.NewRule(kind, "app")
+				if kind == "ts_project" {
+					r.SetAttr("srcs", []string{"app.ts"})
+				} else {
+					r.SetAttr("srcs", []string{"app.js"})
+				}
+				lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"./foo": true}}, label.New("", "lib", "app"))
+				if deps := r.AttrStrings("deps"); !reflect.DeepEqual(deps, []string{want}) {
+					t.Errorf("%s: got deps %v; want [%s]", kind, deps, want)
+				}
+			}
+			if logs := buf.String(); !strings.Contains(logs, "import lib/foo resolved to foo.ts, ignoring foo.js") && !strings.Contains(logs, "import lib/foo resolved to foo.js, ignoring foo.ts") {
+				t.Errorf("expected a warning about the ambiguous import, got %q", logs)
+			}
+		})
+	}
+}
+
+func TestResolveMaxDepsWarn(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD", Directives: []rule.Directive{{Key: "js_max_deps_warn", Value: "2"}}}
+	lang.Configure(c, "lib", f)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, name := range []string{"a", "b", "c"} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{name + ".ts"})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	resolveImports := func(name string, imps ...string) {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{name + ".ts"})
+		set := make(map[string]bool)
+		for _, imp := range imps {
+			set[imp] = true
+		}
+		lang.Resolve(c, ix, nil, r, &imports{set: set}, label.New("", "lib", name))
+	}
+	resolveImports("small", "./a", "./b")
+	resolveImports("large", "./a", "./b", "./c")
+
+	logs := buf.String()
+	if !strings.Contains(logs, "[//lib:large] has 3 deps, more than the 2 allowed by js_max_deps_warn") {
+		t.Errorf("expected a warning for the rule above the threshold, got %q", logs)
+	}
+	if strings.Contains(logs, "//lib:small") {
+		t.Errorf("expected no warning for the rule at the threshold, got %q", logs)
+	}
+}
+
+func TestSourcePath(t *testing.T) {
+	lang := NewLanguage()
+	c := config.New()
+	lang.Configure(c, "", &rule.File{Pkg: ""})
+	lang.Configure(c, "lib", &rule.File{
+		Pkg:        "lib",
+		Directives: []rule.Directive{{Key: "js_outdir_map", Value: "dist=src, bin=., dist/types=types"}},
+	})
+	jsConfig := c.Exts[languageName].(JsConfigs)["lib"]
+
+	for target, want := range map[string]string{
+		"lib/dist/foo":        "lib/src/foo",
+		"lib/dist/foo.js":     "lib/src/foo",
+		"lib/dist/foo.d.ts":   "lib/src/foo",
+		"lib/dist/util/a.mjs": "lib/src/util/a",
+		"lib/dist/styles.css": "lib/src/styles.css",
+		"lib/bin/cli.js":      "lib/cli",
+		"lib/dist/types/a.ts": "lib/types/a.ts",
+		"lib/dist/types/b.js": "lib/types/b",
+		"lib/distant/foo.js":  "lib/distant/foo.js",
+		"lib/src/foo":         "lib/src/foo",
+	} {
+		if got := sourcePath(jsConfig, target); got != want {
+			t.Errorf("sourcePath(%q) = %q, want %q", target, got, want)
+		}
+	}
+}
+
+func TestResolveAliasToNpm(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg: "",
+		Directives: []rule.Directive{
+			{Key: "js_root"},
+			{Key: "js_import_alias", Value: "@polyfill/ core-js/"},
+			{Key: "js_import_alias", Value: "@ui/ src/ui/"},
+			{Key: "js_import_alias", Value: "@ui/ @acme/ui/"},
+		},
+	})
+	jsConfig := c.Exts[languageName].(JsConfigs)[""]
+	jsConfig.NpmDependencies.Dependencies["core-js"] = "@npm//"
+	jsConfig.NpmDependencies.Dependencies["@acme/ui"] = "@npm//"
+	f := &rule.File{Pkg: "src/ui", Path: "src/ui/BUILD"}
+	lang.Configure(c, "src", &rule.File{Pkg: "src"})
+	lang.Configure(c, "src/ui", f)
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	r := rule.NewRule("ts_project", "button")
+	r.SetAttr("srcs", []string{"button.ts"})
+	ix.AddRule(c, r, f)
+	ix.Finish()
+
+	r = rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := &imports{set: map[string]bool{
+		"@polyfill/es/array": true,
+		"@ui/button":         true,
+		"@ui/menu":           true,
+	}}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+	deps := r.AttrStrings("deps")
+	sort.Strings(deps)
+	if want := []string{"//src/ui:button", "@npm//@acme/ui", "@npm//core-js"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+}
+
+func TestResolveBrowserMap(t *testing.T) {
+	repoRoot := t.TempDir()
+	for name, data := range map[string]string{
+		"package.json": `{
+  "dependencies": {"module-a": "^1.0", "module-b": "^1.0", "module-c": "^1.0"},
+  "browser": {"./lib/node.js": "./lib/browser.js", "module-a": "module-b", "module-c": false}
+}`,
+		"lib/node.js":    "",
+		"lib/browser.js": "",
+	} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		browserMap string
+		want       []string
+	}{
+		{
+			browserMap: "false",
+			want:       []string{"//:node_modules/module-a", "//:node_modules/module-c", ":node"},
+		},
+		{
+			browserMap: "true",
+			want:       []string{"//:node_modules/module-b", ":browser"},
+		},
+	} {
+		lang := NewLanguage()
+		c := newResolveConfig(t, repoRoot)
+		lang.Configure(c, "", &rule.File{
+			Pkg:        "",
+			Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_package_file", Value: "package.json :node_modules"}, {Key: "js_browser_map", Value: tc.browserMap}},
+		})
+		f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+		lang.Configure(c, "lib", f)
+
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+		for _, name := range []string{"node", "browser"} {
+			r := rule.NewRule("js_library", name)
+			r.SetAttr("srcs", []string{name + ".js"})
+			ix.AddRule(c, r, f)
+		}
+		ix.Finish()
+
+		r := rule.NewRule("js_library", "main")
+		r.SetAttr("srcs", []string{"main.js"})
+		imps := &imports{set: map[string]bool{
+			"./node":   true,
+			"module-a": true,
+			"module-c": true,
+		}}
+		lang.Resolve(c, ix, nil, r, imps, label.New("", "lib", "main"))
+
+		deps := r.AttrStrings("deps")
+		sort.Strings(deps)
+		if !reflect.DeepEqual(deps, tc.want) {
+			t.Errorf("js_browser_map %s: Inequality.\ngot  %#v;\nwant %#v", tc.browserMap, deps, tc.want)
+		}
+	}
+}
+
+func TestResolveManualMocks(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"__mocks__/axios.ts", "src/client.ts", "src/__mocks__/client.ts", "src/util.ts"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		mocksDir string
+		want     []string
+	}{
+		{
+			mocksDir: "__mocks__",
+			want:     []string{"//:node_modules/axios", "//:package_json", "//__mocks__:axios", "//src/__mocks__:client"},
+		},
+		{
+			mocksDir: "",
+			want:     []string{"//:node_modules/axios", "//:package_json"},
+		},
+	} {
+		lang := NewLanguage()
+		c := newResolveConfig(t, repoRoot)
+		lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_mocks_dir", Value: tc.mocksDir}}})
+		jsConfig := c.Exts[languageName].(JsConfigs)[""]
+		jsConfig.NpmDependencies.Dependencies["axios"] = "//:node_modules/"
+
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+		for _, pkg := range []string{"__mocks__", "src", "src/__mocks__"} {
+			f := &rule.File{Pkg: pkg, Path: pkg + "/BUILD"}
+			lang.Configure(c, pkg, f)
+			for _, src := range []string{"axios.ts", "client.ts", "util.ts"} {
+				if _, err := os.Stat(filepath.Join(repoRoot, pkg, src)); err == nil {
+					r := rule.NewRule("ts_project", strings.TrimSuffix(src, ".ts"))
+					r.SetAttr("srcs", []string{src})
+					ix.AddRule(c, r, f)
+				}
+			}
+		}
+		ix.Finish()
+
+		r := rule.NewRule("jest_test", "client.test")
+		r.SetAttr("srcs", []string{"client.test.ts"})
+		imps := &imports{set: map[string]bool{
+			"axios":    true,
+			"./client": true,
+			"./util":   true,
+		}}
+		lang.Resolve(c, ix, nil, r, imps, label.New("", "src", "client.test"))
+
+		data := r.AttrStrings("data")
+		sort.Strings(data)
+		if !reflect.DeepEqual(data, tc.want) {
+			t.Errorf("js_mocks_dir %q: Inequality.\ngot  %#v;\nwant %#v", tc.mocksDir, data, tc.want)
+		}
+	}
+}
+
+func TestResolveSymlinkedDir(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, "shared", "util.ts"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repoRoot, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../shared", filepath.Join(repoRoot, "app", "shared")); err != nil {
+		t.Fatal(err)
+	}
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	f := &rule.File{Pkg: "shared", Path: "shared/BUILD"}
+	lang.Configure(c, "shared", f)
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	r := rule.NewRule("ts_project", "util")
+	r.SetAttr("srcs", []string{"util.ts"})
+	ix.AddRule(c, r, f)
+	ix.Finish()
+
+	r = rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := &imports{set: map[string]bool{"./shared/util": true}}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+	if deps, want := r.AttrStrings("deps"), []string{"//shared:util"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+}
+
+func TestResolveCSSModuleTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		directive string
+		deps      []string
+	}{
+		{name: "disabled", directive: "false"},
+		{name: "enabled", directive: "true", deps: []string{"//app:card.module.scss.d.ts", ":button.module.css.d"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repoRoot := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(repoRoot, "app"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"button.module.css", "button.module.css.d.ts", "card.module.scss", "card.module.scss.d.ts", "plain.module.css"} {
+				if err := os.WriteFile(filepath.Join(repoRoot, "app", name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			lang := NewLanguage()
+			c := newResolveConfig(t, repoRoot)
+			lang.Configure(c, "", &rule.File{
+				Pkg:        "",
+				Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_css_module_types", Value: tc.directive}},
+			})
+			f := &rule.File{Pkg: "app", Path: "app/BUILD"}
+			lang.Configure(c, "app", f)
+
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			r := rule.NewRule("ts_project", "button.module.css.d")
+			r.SetAttr("srcs", []string{"button.module.css.d.ts"})
+			ix.AddRule(c, r, f)
+			ix.Finish()
+
+			r = rule.NewRule("ts_project", "main")
+			r.SetAttr("srcs", []string{"main.ts"})
+			imps := &imports{set: map[string]bool{
+				"./button.module.css": true,
+				"./card.module.scss":  true,
+				"./plain.module.css":  true,
+			}}
+			lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+			deps := r.AttrStrings("deps")
+			sort.Strings(deps)
+			if !reflect.DeepEqual(deps, tc.deps) {
+				t.Errorf("deps inequality.\ngot  %#v;\nwant %#v", deps, tc.deps)
+			}
+			data := r.AttrStrings("data")
+			sort.Strings(data)
+			if want := []string{"//app:button.module.css", "//app:card.module.scss", "//app:plain.module.css"}; !reflect.DeepEqual(data, want) {
+				t.Errorf("data inequality.\ngot  %#v;\nwant %#v", data, want)
+			}
+		})
+	}
+}
+
+func TestResolveVirtualPrefix(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg:        "",
+		Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_virtual_prefix", Value: "my-loader:=//config:loader, virtual:="}},
+	})
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := &imports{set: map[string]bool{
+		"my-loader:config": true,
+		"virtual:routes":   true,
+	}}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+	if deps := r.AttrStrings("deps"); len(deps) != 0 {
+		t.Errorf("expected no deps, got %#v", deps)
+	}
+	if data, want := r.AttrStrings("data"), []string{"//config:loader"}; !reflect.DeepEqual(data, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", data, want)
+	}
+}
+
+func TestTypesLookup(t *testing.T) {
+	typesNames := make(typesLookup)
+	typesNames.add("@types/lodash", true)
+	for i := 0; i < 100; i++ {
+		typesNames.add("@types/lodash", false)
+		typesNames.add("@types/node", true)
+		typesNames.add("@types/missing", false)
+	}
+
+	lookups := make(map[string]int)
+	depSet := make(map[string]bool)
+	typeDepSet := make(map[string]bool)
+	typesNames.resolve(func(typesName string) (string, bool) {
+		lookups[typesName]++
+		return "//:node_modules/" + typesName, typesName != "@types/missing"
+	}, depSet, typeDepSet)
+
+	if want := map[string]int{"@types/lodash": 1, "@types/node": 1, "@types/missing": 1}; !reflect.DeepEqual(lookups, want) {
+		t.Errorf("lookups: Inequality.\ngot  %#v;\nwant %#v", lookups, want)
+	}
+	if want := map[string]bool{"//:node_modules/@types/lodash": true}; !reflect.DeepEqual(depSet, want) {
+		t.Errorf("depSet: Inequality.\ngot  %#v;\nwant %#v", depSet, want)
+	}
+	if want := map[string]bool{"//:node_modules/@types/node": true}; !reflect.DeepEqual(typeDepSet, want) {
+		t.Errorf("typeDepSet: Inequality.\ngot  %#v;\nwant %#v", typeDepSet, want)
+	}
+}
+
+func TestResolveTypesOnce(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	jsConfig := c.Exts[languageName].(JsConfigs)[""]
+	jsConfig.NpmDependencies.Dependencies["lodash"] = "//:node_modules/"
+	jsConfig.NpmDependencies.DevDependencies["@types/lodash"] = "//:node_modules/"
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	imps := &imports{set: map[string]bool{"lodash": true}}
+	for _, fn := range []string{"chunk", "debounce", "get", "map", "merge", "pick", "set", "throttle"} {
+		imps.set["lodash/"+fn] = true
+	}
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "", "main"))
+
+	deps := r.AttrStrings("deps")
+	sort.Strings(deps)
+	if want := []string{"//:node_modules/@types/lodash", "//:node_modules/lodash"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+	// lodash and @types/lodash are looked up once for all of the subpaths
+	if want := map[string]int{"lodash": 1, "@types/lodash": 1}; !reflect.DeepEqual(lang.npmLookups, want) {
+		t.Errorf("lookups: Inequality.\ngot  %#v;\nwant %#v", lang.npmLookups, want)
+	}
+}
+
+func TestResolveExternalRepo(t *testing.T) {
+	// mapped imports resolve before the parent walk, which stops at the JS root
+	for _, jsRoot := range []string{"", "web"} {
+		t.Run("js_root="+jsRoot, func(t *testing.T) {
+			lang := NewLanguage()
+			c := newResolveConfig(t, t.TempDir())
+			lang.Configure(c, "", &rule.File{
+				Pkg: "",
+				Directives: []rule.Directive{
+					{Key: "js_root", Value: jsRoot},
+					{Key: "js_external_repo", Value: "@shared/=@shared_repo//, @shared/design/=@design_system//packages/"},
+				},
+			})
+			lang.Configure(c, "web", &rule.File{Pkg: "web"})
+			lang.Configure(c, "web/app", &rule.File{Pkg: "web/app"})
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			ix.Finish()
+
+			r := rule.NewRule("ts_project", "main")
+			r.SetAttr("srcs", []string{"main.ts"})
+			imps := &imports{set: map[string]bool{"@shared/lib/format": true, "@shared/ui": true, "@shared/design/button/": true}}
+			lang.Resolve(c, ix, nil, r, imps, label.New("", "web/app", "main"))
+
+			deps := r.AttrStrings("deps")
+			sort.Strings(deps)
+			if want := []string{"@design_system//packages/button", "@shared_repo//lib/format", "@shared_repo//ui"}; !reflect.DeepEqual(deps, want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+			}
+		})
+	}
+}
+
+func TestResolveRootDirs(t *testing.T) {
+	repoRoot := t.TempDir()
+	tsconfig := `{
+  "compilerOptions": {
+    // generated sources are merged with the hand written ones
+    "rootDirs": ["src", "gen"],
+  },
+}`
+	if err := os.WriteFile(filepath.Join(repoRoot, "tsconfig.json"), []byte(tsconfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_tsconfig_root_dirs"}}})
+	f := &rule.File{Pkg: "gen", Path: "gen/BUILD"}
+	lang.Configure(c, "gen", f)
+	lang.Configure(c, "src", &rule.File{Pkg: "src"})
+	lang.Configure(c, "src/app", &rule.File{Pkg: "src/app"})
+
+	jsConfig := c.Exts[languageName].(JsConfigs)["src/app"]
+	if want := []string{"src", "gen"}; !reflect.DeepEqual(jsConfig.RootDirs, want) {
+		t.Fatalf("RootDirs = %#v, want %#v", jsConfig.RootDirs, want)
+	}
+	for target, want := range map[string][]string{
+		"src/app/generated/api": {"gen/app/generated/api"},
+		"gen/app/x":             {"src/app/x"},
+		"lib/x":                 nil,
+	} {
+		if got := rootDirCandidates(jsConfig, target); !reflect.DeepEqual(got, want) {
+			t.Errorf("rootDirCandidates(%q) = %#v, want %#v", target, got, want)
+		}
+	}
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	api := rule.NewRule("ts_project", "api")
+	api.SetAttr("srcs", []string{"app/generated/api.ts"})
+	ix.AddRule(c, api, f)
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"./generated/api": true}}, label.New("", "src/app", "main"))
+
+	if deps, want := r.AttrStrings("deps"), []string{"//gen:api"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+}
+
+func TestResolvePreserveEmptyDeps(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg:        "",
+		Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_preserve_empty_deps", Value: "ts_project, my_macro"}},
+	})
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	for kind, preserved := range map[string]bool{
+		"ts_project": true,
+		"my_macro":   true,
+		"js_library": false,
+	} {
+		r := rule.NewRule(kind, "lib")
+		r.SetAttr("srcs", []string{"lib.ts"})
+		r.SetAttr("deps", []string{"//external:managed"})
+		r.SetAttr("data", []string{})
+		lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{}}, label.New("", "", "lib"))
+
+		if got := r.Attr("deps") != nil; got != preserved {
+			t.Errorf("%s: deps kept = %v, want %v", kind, got, preserved)
+		} else if preserved && !reflect.DeepEqual(r.AttrStrings("deps"), []string{"//external:managed"}) {
+			t.Errorf("%s: deps = %#v", kind, r.AttrStrings("deps"))
+		}
+		if got := r.Attr("data") != nil; got != preserved {
+			t.Errorf("%s: data kept = %v, want %v", kind, got, preserved)
+		}
+	}
+}
+
+func TestResolveScopedNpmSubpaths(t *testing.T) {
+	for _, suffix := range []string{"", "{name}:{name}"} {
+		t.Run(suffix, func(t *testing.T) {
+			lang := NewLanguage()
+			c := newResolveConfig(t, t.TempDir())
+			directives := []rule.Directive{{Key: "js_root"}}
+			if suffix != "" {
+				directives = append(directives, rule.Directive{Key: "js_npm_label_suffix", Value: suffix})
+			}
+			lang.Configure(c, "", &rule.File{Pkg: "", Directives: directives})
+			jsConfig := c.Exts[languageName].(JsConfigs)[""]
+			jsConfig.NpmDependencies.Dependencies["@scope/pkg"] = "//:node_modules/"
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			ix.Finish()
+
+			r := rule.NewRule("js_library", "main")
+			r.SetAttr("srcs", []string{"main.js"})
+			imps := &imports{set: map[string]bool{
+				"@scope/pkg":          true,
+				"@scope/pkg/sub":      true,
+				"@scope/pkg/sub/deep": true,
+			}}
+			lang.Resolve(c, ix, nil, r, imps, label.New("", "", "main"))
+
+			deps := r.AttrStrings("deps")
+			data := r.AttrStrings("data")
+			want := npmPackageLabel("//:node_modules/", "@scope/pkg", jsConfig)
+			if !reflect.DeepEqual(deps, []string{want}) {
+				t.Errorf("deps = %#v, want %#v", deps, []string{want})
+			}
+			if !reflect.DeepEqual(data, deps) {
+				t.Errorf("data = %#v, want the deps %#v", data, deps)
+			}
+		})
+	}
+}
+
+func TestResolveRuleNameSuffix(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_rule_name_suffix", Value: "_ts, _js"}}})
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD"}
+	lang.Configure(c, "lib", f)
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	// my_ts_lib(name = "foo") generates foo_ts, and util is indexed under both names
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for name, src := range map[string]string{"foo_ts": "foo.ts", "util": "util.ts", "util_ts": "util.ts"} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{src})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	for _, tc := range []struct {
+		from label.Label
+		imps []string
+		want []string
+	}{
+		{from: label.New("", "app", "main"), imps: []string{"../lib/foo", "../lib/util"}, want: []string{"//lib:foo", "//lib:util"}},
+		{from: label.New("", "lib", "bar"), imps: []string{"./foo"}, want: []string{":foo"}},
+		{from: label.New("", "lib", "foo"), imps: []string{"./foo"}, want: nil},
+	} {
+		r := rule.NewRule("ts_project", tc.from.Name)
+		r.SetAttr("srcs", []string{tc.from.Name + ".ts"})
+		imps := &imports{set: map[string]bool{}}
+		for _, imp := range tc.imps {
+			imps.set[imp] = true
+		}
+		lang.Resolve(c, ix, nil, r, imps, tc.from)
+
+		deps := r.AttrStrings("deps")
+		sort.Strings(deps)
+		if !reflect.DeepEqual(deps, tc.want) {
+			t.Errorf("%s: Inequality.\ngot  %#v;\nwant %#v", tc.from, deps, tc.want)
+		}
+	}
+}
+
+func TestResolveContext(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_context_attr", Value: "tags"}}})
+	f := &rule.File{Pkg: "shared", Path: "shared/BUILD"}
+	lang.Configure(c, "shared", f)
+	lang.Configure(c, "web", &rule.File{Pkg: "web", Directives: []rule.Directive{{Key: "js_context", Value: "web"}}})
+	lang.Configure(c, "server", &rule.File{Pkg: "server", Directives: []rule.Directive{{Key: "js_context", Value: "node"}}})
+	lang.Configure(c, "other", &rule.File{Pkg: "other"})
+
+	// util.ts is compiled for both web and node
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for name, context := range map[string]string{"util_web": "web", "util_node": "node"} {
+		r := rule.NewRule("ts_project", name)
+		r.SetAttr("srcs", []string{"util.ts"})
+		r.SetAttr("tags", []string{context})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	for _, tc := range []struct {
+		from label.Label
+		want label.Label
+	}{
+		{from: label.New("", "web", "app"), want: label.New("", "shared", "util_web")},
+		{from: label.New("", "server", "main"), want: label.New("", "shared", "util_node")},
+	} {
+		result := lang.tryResolve("shared/util.ts", c, ix, tc.from)
+		if result.err != nil {
+			t.Fatalf("%s: %v", tc.from, result.err)
+		}
+		if !result.label.Equal(tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.from, result.label, tc.want)
+		}
+	}
+
+	// importers without a context still report both rules
+	if result := lang.tryResolve("shared/util.ts", c, ix, label.New("", "other", "lib")); result.err == nil {
+		t.Errorf("expected multiple matches, got %s", result.label)
+	}
+}
+
+// protoResolver indexes proto_library rules by their srcs, like the proto
+// extension of gazelle
+type protoResolver struct{}
+
+func (protoResolver) Name() string { return "proto" }
+
+func (protoResolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	specs := make([]resolve.ImportSpec, 0)
+	for _, src := range r.AttrStrings("srcs") {
+		specs = append(specs, resolve.ImportSpec{Lang: "proto", Imp: path.Join(f.Pkg, src)})
+	}
+	return specs
+}
+
+func (protoResolver) Embeds(r *rule.Rule, from label.Label) []label.Label { return nil }
+
+func (protoResolver) Resolve(c *config.Config, ix *resolve.RuleIndex, rc *repo.RemoteCache, r *rule.Rule, imports interface{}, from label.Label) {
+}
+
+func TestResolveGenSuffix(t *testing.T) {
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{
+		Pkg:        "",
+		Directives: []rule.Directive{{Key: "js_root"}, {Key: "js_gen_suffix", Value: "_pb=proto, _connect=proto"}},
+	})
+	f := &rule.File{Pkg: "api", Path: "api/BUILD"}
+	lang.Configure(c, "api", f)
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver {
+		if r.Kind() == "proto_library" {
+			return protoResolver{}
+		}
+		return lang
+	})
+	for name, src := range map[string]string{"user_proto": "user.proto", "billing_proto": "billing.proto"} {
+		r := rule.NewRule("proto_library", name)
+		r.SetAttr("srcs", []string{src})
+		ix.AddRule(c, r, f)
+	}
+	ix.Finish()
+
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	imps := &imports{set: map[string]bool{
+		"../api/user_pb":         true,
+		"../api/billing_connect": true,
+	}}
+	lang.Resolve(c, ix, nil, r, imps, label.New("", "app", "main"))
+
+	deps := r.AttrStrings("deps")
+	sort.Strings(deps)
+	if want := []string{"//api:billing_proto", "//api:user_proto"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, want)
+	}
+}
+
+func TestFirstPartyPackage(t *testing.T) {
+	jsConfig := NewJsConfig()
+	jsConfig.FirstParty["foo"] = label.New("", "packages/foo", "foo")
+	jsConfig.FirstParty["@acme/bar"] = label.New("", "packages/bar", "index")
+
+	for _, tc := range []struct {
+		imp     string
+		label   string
+		subpath string
+		ok      bool
+	}{
+		{imp: "foo", label: "//packages/foo", ok: true},
+		{imp: "foo/utils/format", label: "//packages/foo", subpath: "utils/format", ok: true},
+		{imp: "@acme/bar", label: "//packages/bar:index", ok: true},
+		{imp: "@acme/bar/format", label: "//packages/bar:index", subpath: "format", ok: true},
+		{imp: "foobar", ok: false},
+		{imp: "@acme/baz", ok: false},
+	} {
+		lbl, subpath, ok := firstPartyPackage(tc.imp, jsConfig)
+		if ok != tc.ok {
+			t.Errorf("firstPartyPackage(%q) ok = %v, want %v", tc.imp, ok, tc.ok)
+			continue
+		}
+		if ok && (lbl.String() != tc.label || subpath != tc.subpath) {
+			t.Errorf("firstPartyPackage(%q) = %s, %q, want %s, %q", tc.imp, lbl, subpath, tc.label, tc.subpath)
+		}
+	}
+}
+
+func TestResolveDirImportFallback(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, file := range []string{
+		"lib/components/Button.ts",
+		"lib/components/forms/Input.ts",
+		"lib/components/legacy/BUILD",
+		"lib/components/legacy/Old.ts",
+		"lib/components/node_modules/dep/index.js",
+		"lib/components/generated/Gen.ts",
+		"lib/widgets/Card.ts",
+	} {
+		if err := os.MkdirAll(filepath.Join(repoRoot, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		mode, imp string
+		want      map[string]bool
+	}{
+		{mode: "error", imp: "./components"},
+		{mode: "filegroup", imp: "./components", want: map[string]bool{"//lib/components": true}},
+		// there is no //lib/widgets rule
+		{mode: "filegroup", imp: "./widgets"},
+		// subpackages, node_modules and excluded files are skipped
+		{mode: "glob", imp: "./components", want: map[string]bool{"//lib/components:Button": true, "//lib/components/forms:Input": true}},
+	} {
+		t.Run(tc.mode+" "+tc.imp, func(t *testing.T) {
+			lang := NewLanguage().(*JS)
+			c := newResolveConfig(t, repoRoot)
+			c.ValidBuildFileNames = []string{"BUILD.bazel", "BUILD"}
+			lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+			lang.Configure(c, "lib", &rule.File{Pkg: "lib", Path: "lib/BUILD", Directives: []rule.Directive{{Key: "js_dir_import_fallback", Value: tc.mode}}})
+
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			// parents are configured before their subpackages
+			for _, src := range []struct{ pkg, kind, name, src string }{
+				{"lib/components", "ts_project", "Button", "Button.ts"},
+				{"lib/components", "filegroup", "components", "Button.ts"},
+				{"lib/components", "ts_project", "Gen", "generated/Gen.ts"},
+				{"lib/components/forms", "ts_project", "Input", "Input.ts"},
+				{"lib/components/legacy", "ts_project", "Old", "Old.ts"},
+				{"lib/widgets", "ts_project", "Card", "Card.ts"},
+			} {
+				f := &rule.File{Pkg: src.pkg, Path: src.pkg + "/BUILD"}
+				lang.Configure(c, src.pkg, f)
+				r := rule.NewRule(src.kind, src.name)
+				r.SetAttr("srcs", []string{src.src})
+				ix.AddRule(c, r, f)
+			}
+			ix.Finish()
+
+			// generated sources are only excluded for the importer
+			jsConfig := c.Exts[languageName].(JsConfigs)["lib"]
+			jsConfig.ExclusionPattern = regexp.MustCompile(`^lib/components/generated/`)
+
+			depSet := map[string]bool{}
+			err := lang.resolveWalkParents(tc.imp, depSet, map[string]bool{}, c, ix, nil, nil, label.New("", "lib", "app"))
+			if tc.want == nil {
+				var unresolved *UnresolvedImportError
+				if !errors.As(err, &unresolved) || unresolved.Dir != path.Join("lib", tc.imp) {
+					t.Fatalf("expected an UnresolvedImportError for %s, got %v", tc.imp, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(depSet, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", depSet, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveCompoundExtensions(t *testing.T) {
+	repoRoot := t.TempDir()
+	files := []string{"lib/foo.ts", "lib/foo.test.ts", "lib/foo.stories.tsx", "lib/bar.test.ts", "lib/types.d.ts", "lib/widgets/Button.tsx", "lib/widgets/Button.test.tsx"}
+	for _, file := range files {
+		if err := os.MkdirAll(filepath.Join(repoRoot, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	f := &rule.File{Pkg: "lib", Path: "lib/BUILD", Directives: []rule.Directive{
+		{Key: "js_dir_import_fallback", Value: "glob"},
+		{Key: "js_resolve_ignored_suffixes", Value: ".test, .stories"},
+	}}
+	lang.Configure(c, "lib", f)
+	widgets := &rule.File{Pkg: "lib/widgets", Path: "lib/widgets/BUILD"}
+	lang.Configure(c, "lib/widgets", widgets)
+
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, src := range []struct {
+		f          *rule.File
+		kind, name string
+		src        string
+	}{
+		{f, "ts_project", "foo", "foo.ts"},
+		{f, "jest_test", "foo_test", "foo.test.ts"},
+		{f, "ts_project", "foo_stories", "foo.stories.tsx"},
+		{f, "jest_test", "bar_test", "bar.test.ts"},
+		{f, "ts_project", "types", "types.d.ts"},
+		{widgets, "ts_project", "Button", "Button.tsx"},
+		{widgets, "jest_test", "Button_test", "Button.test.tsx"},
+	} {
+		r := rule.NewRule(src.kind, src.name)
+		r.SetAttr("srcs", []string{src.src})
+		ix.AddRule(c, r, src.f)
+	}
+	ix.Finish()
+
+	for _, tc := range []struct {
+		imp  string
+		want map[string]bool
+	}{
+		{imp: "./foo", want: map[string]bool{":foo": true}},
+		{imp: "./foo.stories", want: map[string]bool{":foo_stories": true}},
+		{imp: "./foo.test", want: map[string]bool{":foo_test": true}},
+		{imp: "./types.d.ts", want: map[string]bool{":types": true}},
+		{imp: "./types", want: map[string]bool{":types": true}},
+		// the glob fallback skips the test of the widget
+		{imp: "./widgets", want: map[string]bool{"//lib/widgets:Button": true}},
+		// the test is the only bar file
+		{imp: "./bar"},
+	} {
+		depSet := map[string]bool{}
+		err := lang.resolveWalkParents(tc.imp, depSet, map[string]bool{}, c, ix, nil, nil, label.New("", "lib", "app"))
+		if tc.want == nil {
+			var unresolved *UnresolvedImportError
+			if !errors.As(err, &unresolved) {
+				t.Errorf("%s: expected an UnresolvedImportError, got %v", tc.imp, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.imp, err)
+		}
+		if !reflect.DeepEqual(depSet, tc.want) {
+			t.Errorf("%s: Inequality.\ngot  %#v;\nwant %#v", tc.imp, depSet, tc.want)
+		}
+	}
+}
+
+func TestResolveNestedJSRoot(t *testing.T) {
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: ""})
+	lang.Configure(c, "frontend", &rule.File{Pkg: "frontend"})
+	lang.Configure(c, "frontend/src", &rule.File{Pkg: "frontend/src", Directives: []rule.Directive{{Key: "js_root"}}})
+	for _, pkg := range []string{"frontend/src/app", "frontend/src/app/components"} {
+		lang.Configure(c, pkg, &rule.File{Pkg: pkg})
+	}
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	// the walk stops exactly at the JS root
+	err := lang.resolveWalkParents("utils", map[string]bool{}, map[string]bool{}, c, ix, nil, nil, label.New("", "frontend/src/app/components", "a"))
+	var unresolved *UnresolvedImportError
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected an UnresolvedImportError, got %v", err)
+	}
+	want := []string{
+		"frontend/src/app/components/utils",
+		"frontend/src/app/utils",
+		"frontend/src/utils",
+	}
+	if got := tryDirs(unresolved.Tries); !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+
+	// the walk from the root package stops at the repository root
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	err = lang.resolveWalkParents("utils", map[string]bool{}, map[string]bool{}, c, ix, nil, nil, label.New("", "", "a"))
+	if !errors.As(err, &unresolved) {
+		t.Fatalf("expected an UnresolvedImportError, got %v", err)
+	}
+	if got, want := tryDirs(unresolved.Tries), []string{"utils"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", got, want)
+	}
+}
+
+// tryDirs returns the paths tried without an extension
+func tryDirs(tries []string) []string {
+	dirs := []string{}
+	for _, try := range tries {
+		if path.Ext(try) == "" {
+			dirs = append(dirs, try)
+		}
+	}
+	return dirs
+}
+
+func TestResolveQuietSubpackage(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	lang := NewLanguage()
+	c := newResolveConfig(t, t.TempDir())
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+	lang.Configure(c, "app", &rule.File{Pkg: "app"})
+	lang.Configure(c, "app/generated", &rule.File{Pkg: "app/generated", Directives: []rule.Directive{{Key: "js_quiet", Value: "true"}}})
+	lang.Configure(c, "app/generated/api", &rule.File{Pkg: "app/generated/api"})
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	ix.Finish()
+
+	for _, pkg := range []string{"app", "app/generated", "app/generated/api"} {
+		r := rule.NewRule("ts_project", "a")
+		r.SetAttr("srcs", []string{"a.ts"})
+		lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"missing-module": true}}, label.New("", pkg, "a"))
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, "[//app:a] import missing-module not found") {
+		t.Errorf("expected the parent package to log the missing import, got %q", logs)
+	}
+	// the quieted package and its subpackages are silent
+	if strings.Contains(logs, "//app/generated") {
+		t.Errorf("expected the quieted packages not to log, got %q", logs)
+	}
+}
+
+func TestResolveQuietRelative(t *testing.T) {
+	for _, tc := range []struct {
+		directives []rule.Directive
+		want       []string
+	}{
+		{
+			directives: nil,
+			want:       []string{"import ./missing not found", "import missing-module not found"},
+		},
+		{
+			directives: []rule.Directive{{Key: "js_quiet"}},
+			want:       []string{"import ./missing not found"},
+		},
+		{
+			directives: []rule.Directive{{Key: "js_quiet"}, {Key: "js_quiet_relative"}},
+			want:       nil,
+		},
+	} {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+		lang := NewLanguage()
+		c := newResolveConfig(t, t.TempDir())
+		lang.Configure(c, "", &rule.File{Pkg: "", Directives: append([]rule.Directive{{Key: "js_root"}}, tc.directives...)})
+		lang.Configure(c, "app", &rule.File{Pkg: "app"})
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+		ix.Finish()
+
+		r := rule.NewRule("ts_project", "a")
+		r.SetAttr("srcs", []string{"a.ts"})
+		lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"./missing": true, "missing-module": true}}, label.New("", "app", "a"))
+
+		got := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if i := strings.Index(line, "import "); i >= 0 {
+				got = append(got, strings.TrimSuffix(line[i:], "\x1b[0m"))
+			}
+		}
+		sort.Strings(got)
+		if len(got) != len(tc.want) || (len(got) > 0 && !reflect.DeepEqual(got, tc.want)) {
+			t.Errorf("%v: got %q; want %q", tc.directives, got, tc.want)
+		}
+	}
+}
+
+func TestResolveFromRoot(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, name := range []string{"src/utils/format.ts", "src/app/utils/format.ts", "src/lodash/index.ts"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoRoot, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		fromRoot bool
+		want     []string
+	}{
+		{fromRoot: false, want: []string{"//src/app/utils:format", "@npm//lodash"}},
+		{fromRoot: true, want: []string{"//src/utils:format", "@npm//lodash"}},
+	} {
+		lang := NewLanguage()
+		c := newResolveConfig(t, repoRoot)
+		lang.Configure(c, "", &rule.File{Pkg: ""})
+		f := &rule.File{Pkg: "src", Path: "src/BUILD", Directives: []rule.Directive{{Key: "js_root"}}}
+		if tc.fromRoot {
+			f.Directives = append(f.Directives, rule.Directive{Key: "js_resolve_from_root"})
+		}
+		lang.Configure(c, "src", f)
+		jsConfig := c.Exts[languageName].(JsConfigs)["src"]
+		jsConfig.NpmDependencies.Dependencies["lodash"] = "@npm//"
+		for _, pkg := range []string{"src/app", "src/app/pages", "src/app/utils", "src/utils"} {
+			lang.Configure(c, pkg, &rule.File{Pkg: pkg})
+		}
+
+		ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+		for _, pkg := range []string{"src/app/utils", "src/utils"} {
+			r := rule.NewRule("ts_project", "format")
+			r.SetAttr("srcs", []string{"format.ts"})
+			ix.AddRule(c, r, &rule.File{Pkg: pkg, Path: pkg + "/BUILD"})
+		}
+		ix.Finish()
+
+		r := rule.NewRule("ts_project", "home")
+		r.SetAttr("srcs", []string{"home.ts"})
+		lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"utils/format": true, "lodash": true}}, label.New("", "src/app/pages", "home"))
+		deps := r.AttrStrings("deps")
+		sort.Strings(deps)
+		if !reflect.DeepEqual(deps, tc.want) {
+			t.Errorf("js_resolve_from_root %v: got deps %v; want %v", tc.fromRoot, deps, tc.want)
+		}
+	}
+}
+
+func TestResolveProjectReference(t *testing.T) {
+	repoRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repoRoot, "shared", "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoRoot, "shared", "src", "format.ts"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		want map[string]bool
+	}{
+		{name: "shared", want: map[string]bool{"//shared": true}},
+		// the project is not provided by //shared
+		{name: "format"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lang := NewLanguage().(*JS)
+			c := newResolveConfig(t, repoRoot)
+			lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{{Key: "js_root"}}})
+			lang.Configure(c, "app", &rule.File{Pkg: "app", Path: "app/BUILD"})
+			c.Exts[languageName].(JsConfigs)["app"].ProjectReferences = []string{"shared"}
+
+			ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+			f := &rule.File{Pkg: "shared", Path: "shared/BUILD"}
+			lang.Configure(c, "shared", f)
+			r := rule.NewRule("ts_project", tc.name)
+			r.SetAttr("srcs", []string{"src/format.ts"})
+			ix.AddRule(c, r, f)
+			ix.Finish()
+
+			depSet := map[string]bool{}
+			err := lang.resolveWalkParents("../shared/dist/format", depSet, map[string]bool{}, c, ix, nil, nil, label.New("", "app", "app"))
+			if tc.want == nil {
+				var unresolved *UnresolvedImportError
+				if !errors.As(err, &unresolved) {
+					t.Fatalf("expected an UnresolvedImportError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(depSet, tc.want) {
+				t.Errorf("Inequality.\ngot  %#v;\nwant %#v", depSet, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveWorkspacePackage(t *testing.T) {
+	repoRoot := t.TempDir()
+	for name, content := range map[string]string{
+		"package.json":                  `{"dependencies": {"@myorg/shared": "workspace:*"}}`,
+		"packages/shared/package.json":  `{"name": "@myorg/shared", "exports": {".": "./src/index.ts"}}`,
+		"packages/shared/src/index.ts":  "",
+		"packages/library/package.json": `{"name": "@myorg/library"}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(repoRoot, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoRoot, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lang := NewLanguage().(*JS)
+	c := newResolveConfig(t, repoRoot)
+	lang.Configure(c, "", &rule.File{Pkg: "", Directives: []rule.Directive{
+		{Key: "js_root"},
+		{Key: "js_package_file", Value: "package.json @npm//"},
+		{Key: "js_scoped_package_files"},
+	}})
+	ix := resolve.NewRuleIndex(func(r *rule.Rule, pkgRel string) resolve.Resolver { return lang })
+	for _, pkg := range []string{"packages", "packages/library", "packages/shared", "app"} {
+		lang.Configure(c, pkg, &rule.File{Pkg: pkg, Path: pkg + "/BUILD"})
+	}
+	f := &rule.File{Pkg: "packages/shared", Path: "packages/shared/BUILD"}
+	shared := rule.NewRule("ts_project", "shared")
+	shared.SetAttr("srcs", []string{"src/index.ts"})
+	ix.AddRule(c, shared, f)
+	ix.Finish()
+
+	// the names of workspace packages are mapped once, by Configure
+	want := map[string]string{"@myorg/shared": "packages/shared", "@myorg/library": "packages/library"}
+	if !reflect.DeepEqual(lang.workspaceDirs, want) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", lang.workspaceDirs, want)
+	}
+
+	r := rule.NewRule("ts_project", "main")
+	r.SetAttr("srcs", []string{"main.ts"})
+	lang.Resolve(c, ix, nil, r, &imports{set: map[string]bool{"@myorg/shared": true}}, label.New("", "app", "main"))
+	if deps := r.AttrStrings("deps"); !reflect.DeepEqual(deps, []string{"//packages/shared"}) {
+		t.Errorf("Inequality.\ngot  %#v;\nwant %#v", deps, []string{"//packages/shared"})
+	}
+}
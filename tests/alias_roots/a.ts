@@ -0,0 +1,5 @@
+import { other } from "@/other";
+import { thing } from "@/thing";
+import { tilde } from "~/tilde";
+
+var _ = other + thing + tilde;
@@ -0,0 +1 @@
+export var thing = "World";
@@ -0,0 +1,4 @@
+import logo from './logo.svg';
+import widget from 'legacy-widget';
+
+var _ = widget(logo)
@@ -0,0 +1,6 @@
+declare module '*.svg' {
+  const content: string;
+  export default content;
+}
+
+declare module 'legacy-widget';
@@ -0,0 +1,5 @@
+import { Buffer } from "node:buffer";
+import { createHash } from "crypto";
+import { readFile } from "fs";
+
+var _ = [Buffer, createHash, readFile];
@@ -0,0 +1,4 @@
+import { Button } from "./widgets/button";
+import { util } from "./shared/util";
+
+util(Button);
@@ -0,0 +1 @@
+export function util(x: unknown) {}
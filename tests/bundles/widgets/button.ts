@@ -0,0 +1,6 @@
+import { Icon } from "./icon";
+import { util } from "../shared/util";
+
+util(Icon);
+
+export const Button = "button";
@@ -0,0 +1 @@
+export const Icon = "icon";
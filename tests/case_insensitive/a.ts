@@ -0,0 +1,3 @@
+import { some_var } from "./B";
+
+var _ = some_var;
@@ -0,0 +1,4 @@
+import { utils } from "./utils";
+import { shared } from "../../shared";
+
+var _ = utils + shared;
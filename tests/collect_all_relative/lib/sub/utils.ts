@@ -0,0 +1 @@
+export var utils = "World";
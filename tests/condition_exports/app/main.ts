@@ -0,0 +1,3 @@
+import { x } from 'my-lib';
+
+var _ = x;
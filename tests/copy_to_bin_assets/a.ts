@@ -0,0 +1,4 @@
+import logo from './assets/logo.svg';
+import font from './assets/inter.woff2';
+
+var _ = [logo, font]
@@ -0,0 +1,3 @@
+import { Button, Star } from '@app/ui';
+
+console.log(Button, Star);
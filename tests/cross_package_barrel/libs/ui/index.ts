@@ -0,0 +1,2 @@
+export * from '@app/icons';
+export { Button } from './button';
@@ -0,0 +1,3 @@
+import { Button } from "./lib";
+
+var _ = Button;
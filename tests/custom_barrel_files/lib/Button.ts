@@ -0,0 +1,3 @@
+const Button = () => null;
+
+export default Button;
@@ -0,0 +1 @@
+export { default as Button } from './Button';
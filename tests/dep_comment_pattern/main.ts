@@ -0,0 +1,2 @@
+// @needs:./polyfills
+export const main = () => globalThis.structuredClone({});
@@ -0,0 +1,3 @@
+import * as components from "./components";
+
+console.log(components);
@@ -0,0 +1,3 @@
+import { render } from "@myorg/ui";
+
+render();
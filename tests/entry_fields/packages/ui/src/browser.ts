@@ -0,0 +1 @@
+export const render = () => document.body;
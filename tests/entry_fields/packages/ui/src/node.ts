@@ -0,0 +1 @@
+export const render = () => process.stdout;
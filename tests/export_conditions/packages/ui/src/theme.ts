@@ -0,0 +1 @@
+export const theme = { debug: false };
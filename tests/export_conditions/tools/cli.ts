@@ -0,0 +1,4 @@
+import { render } from "@myorg/ui";
+import { theme } from "@myorg/ui/theme";
+
+render(theme);
@@ -0,0 +1,4 @@
+import logo from './assets/logo.png';
+import font from './assets/inter.woff2';
+
+var _ = [logo, font]
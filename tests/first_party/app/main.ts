@@ -0,0 +1,5 @@
+import { greet } from "foo";
+import { bar } from "@acme/bar";
+import { format } from "@acme/bar/format";
+
+console.log(format(greet(bar)));
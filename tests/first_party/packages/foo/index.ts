@@ -0,0 +1 @@
+export { greet } from "./greet";
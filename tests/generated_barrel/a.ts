@@ -0,0 +1,3 @@
+import { some_var } from "./codegen";
+
+var _ = some_var;
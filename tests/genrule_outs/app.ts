@@ -0,0 +1,3 @@
+import { ApiClient } from "./api/client";
+
+new ApiClient().ping();
@@ -0,0 +1,4 @@
+import { other } from "@app/other";
+import { thing } from "@app/thing";
+
+var _ = other + thing;
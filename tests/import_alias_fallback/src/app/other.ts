@@ -0,0 +1 @@
+export var other = "Hello";
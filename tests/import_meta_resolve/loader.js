@@ -0,0 +1 @@
+export const load = () => import(import.meta.resolve("./plugin"));
@@ -0,0 +1 @@
+export const pluginURL = import.meta.resolve("../plugin");
@@ -0,0 +1,5 @@
+import { b } from './b';
+
+const logo = new URL('./logo.png', import.meta.url);
+
+var _ = b(logo)
@@ -0,0 +1 @@
+export const b = (url: URL) => url.href;
@@ -0,0 +1,7 @@
+import Icon from './icon.svg?react';
+import styles from './styles.css?inline';
+import logoUrl from './logo.svg?url';
+
+var _ = Icon
+var _ = styles
+var _ = logoUrl
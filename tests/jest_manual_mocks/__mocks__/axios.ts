@@ -0,0 +1,3 @@
+export default {
+  get: () => Promise.resolve({ data: { name: "mock" } }),
+};
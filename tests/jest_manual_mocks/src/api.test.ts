@@ -0,0 +1,6 @@
+import axios from "axios";
+import { fetchUser } from "./api";
+
+it("fetches the user through the axios mock", async () => {
+  expect(await fetchUser()).toEqual(await axios.get("/user"));
+});
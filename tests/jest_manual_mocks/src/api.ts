@@ -0,0 +1,3 @@
+import axios from "axios";
+
+export const fetchUser = () => axios.get("/user");
@@ -0,0 +1,3 @@
+import { format } from "@lib/format";
+
+console.log(format(1));
@@ -0,0 +1 @@
+export const format = (x) => String(x);
@@ -0,0 +1,7 @@
+const yargs = require("yargs");
+
+const banner = `
+import React from "react";
+`;
+
+yargs.command("generate", "print a component", () => console.log(banner)).parse();
@@ -0,0 +1,6 @@
+import map from "lodash/map";
+
+// optional in commonjs builds only
+const pad = typeof require === "function" ? require("left-pad") : null;
+
+export const helper = () => map([1, 2, 3], (n) => (pad ? pad(n, 2) : n));
@@ -0,0 +1,4 @@
+import chunk from "lodash/chunk";
+import { helper } from "./helper.js";
+
+console.log(chunk(helper(), 2));
@@ -0,0 +1 @@
+const lodash = require("lodash");
@@ -0,0 +1,3 @@
+/// <reference types="node" />
+
+export const env = process.env;
@@ -0,0 +1,3 @@
+import { join } from "node:path";
+
+export const p = join("a", "b");
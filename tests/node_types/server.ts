@@ -0,0 +1,3 @@
+import { readFile } from "node:fs";
+
+readFile("a.txt", () => {});
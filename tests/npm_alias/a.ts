@@ -0,0 +1,4 @@
+import * as React from "my-react";
+import { jsx } from "my-react/jsx-runtime";
+
+console.log(React, jsx);
@@ -0,0 +1,6 @@
+import 'bootstrap/dist/css/bootstrap.css';
+import logo from '@fontsource/inter/files/logo.png';
+import React from 'react';
+
+var _ = logo
+var _ = React
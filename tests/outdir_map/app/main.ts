@@ -0,0 +1,3 @@
+import { foo } from "../dist/foo.js";
+
+console.log(foo);
@@ -0,0 +1,4 @@
+import { x } from 'my-app';
+import { format } from 'my-app/utils/format';
+
+var _ = format(`${x}`)
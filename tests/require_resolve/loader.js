@@ -0,0 +1,6 @@
+const { execFileSync } = require("child_process");
+
+const plugin = require.resolve("./plugin");
+const cli = require.resolve("some-pkg/bin/cli.js");
+
+execFileSync(process.execPath, [cli, plugin]);
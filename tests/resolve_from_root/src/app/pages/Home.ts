@@ -0,0 +1,5 @@
+import { Button } from "app/components/Button";
+import { format } from "utils/format";
+import map from "lodash/map";
+
+export const Home = map([Button], format);
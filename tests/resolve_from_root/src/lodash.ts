@@ -0,0 +1 @@
+export const own = "shadowed by the npm package";
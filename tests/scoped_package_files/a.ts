@@ -0,0 +1,3 @@
+import lodash from "lodash";
+
+var _ = lodash;
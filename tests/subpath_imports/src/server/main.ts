@@ -0,0 +1,4 @@
+import { env } from "#env";
+import { format } from "#internal/format";
+
+console.log(format(env));
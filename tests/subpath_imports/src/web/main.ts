@@ -0,0 +1,3 @@
+import { env } from "#env";
+
+document.title = env;
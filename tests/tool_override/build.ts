@@ -0,0 +1,9 @@
+import { execFileSync } from "child_process";
+import { fileURLToPath } from "url";
+import { client } from "api-client";
+
+const codegen = new URL("codegen", import.meta.url);
+const formatter = new URL("./tools/format.sh", import.meta.url);
+
+execFileSync(fileURLToPath(codegen), [client.schema]);
+execFileSync(fileURLToPath(formatter));
@@ -0,0 +1,4 @@
+/// <reference path="./types.d.ts" />
+/// <reference types="node" />
+
+declare const env: NodeJS.ProcessEnv & Config;
@@ -0,0 +1,3 @@
+interface Config {
+  apiUrl: string;
+}
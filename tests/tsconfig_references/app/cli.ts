@@ -0,0 +1,3 @@
+import { format } from "../shared/src/format";
+
+console.log(format(" cli "));
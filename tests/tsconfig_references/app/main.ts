@@ -0,0 +1,3 @@
+import { format } from "../shared/dist/format";
+
+console.log(format(" main "));
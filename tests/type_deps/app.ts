@@ -0,0 +1,4 @@
+import { v } from "./lib";
+import type { T } from "./model";
+
+export const app: T = String(v);
@@ -0,0 +1,4 @@
+import type { T } from "./model";
+import { m } from "./model";
+
+export const both: T = String(m);
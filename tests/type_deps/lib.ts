@@ -0,0 +1 @@
+export const v = 1;
@@ -0,0 +1,3 @@
+export type T = string;
+
+export const m = 1;
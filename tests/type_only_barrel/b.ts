@@ -0,0 +1 @@
+export type B = "b";
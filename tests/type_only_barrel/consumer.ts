@@ -0,0 +1,3 @@
+import type { A, B } from "./types";
+
+export const value: A = { a: "b" as B };
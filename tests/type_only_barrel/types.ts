@@ -0,0 +1,2 @@
+export type { A } from "./a";
+export type { B } from "./b";
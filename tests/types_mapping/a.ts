@@ -0,0 +1,5 @@
+import { readFile } from "fs";
+import { join } from "path";
+import lodash from "lodash-es";
+
+var _ = [readFile, join, lodash];
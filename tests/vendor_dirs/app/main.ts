@@ -0,0 +1,4 @@
+import $ from '../vendor/jquery';
+import { x } from './x';
+
+var _ = $(x)
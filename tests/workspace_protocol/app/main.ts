@@ -0,0 +1,5 @@
+import { shared } from "@myorg/shared";
+import { format } from "utils-lib/format";
+import map from "lodash/map";
+
+console.log(map([shared], format));